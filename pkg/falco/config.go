@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"bytes"
+
+	"github.com/falcosecurity/testing/pkg/run"
+	"gopkg.in/yaml.v3"
+)
+
+// Ptr returns a pointer to the given value. This is useful for
+// setting the optional fields of Config.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Config is a typed model of the Falco configuration file (i.e. falco.yaml).
+// Only non-nil fields are marshaled, so that a Config can be used both as
+// a whole configuration and as a partial override of another one. Keys
+// that are not modeled can be set through Extra.
+type Config struct {
+	ConfigFiles          []string                    `yaml:"config_files,omitempty"`
+	WatchConfigFiles     *bool                       `yaml:"watch_config_files,omitempty"`
+	RulesFiles           []string                    `yaml:"rules_files,omitempty"`
+	Rules                []RulesSelectionConfig      `yaml:"rules,omitempty"`
+	Engine               *EngineConfig               `yaml:"engine,omitempty"`
+	LoadPlugins          []string                    `yaml:"load_plugins,omitempty"`
+	Plugins              []PluginConfig              `yaml:"plugins,omitempty"`
+	TimeFormatISO8601    *bool                       `yaml:"time_format_iso_8601,omitempty"`
+	Priority             Priority                    `yaml:"priority,omitempty"`
+	JSONOutput           *bool                       `yaml:"json_output,omitempty"`
+	JSONIncludeOutput    *bool                       `yaml:"json_include_output_property,omitempty"`
+	JSONIncludeTags      *bool                       `yaml:"json_include_tags_property,omitempty"`
+	BufferedOutputs      *bool                       `yaml:"buffered_outputs,omitempty"`
+	RuleMatching         string                      `yaml:"rule_matching,omitempty"`
+	OutputsQueue         *OutputsQueueConfig         `yaml:"outputs_queue,omitempty"`
+	AppendOutput         []AppendOutputConfig        `yaml:"append_output,omitempty"`
+	StdoutOutput         *EnabledConfig              `yaml:"stdout_output,omitempty"`
+	SyslogOutput         *EnabledConfig              `yaml:"syslog_output,omitempty"`
+	FileOutput           *FileOutputConfig           `yaml:"file_output,omitempty"`
+	HTTPOutput           *HTTPOutputConfig           `yaml:"http_output,omitempty"`
+	ProgramOutput        *ProgramOutputConfig        `yaml:"program_output,omitempty"`
+	GRPCOutput           *EnabledConfig              `yaml:"grpc_output,omitempty"`
+	GRPC                 *GRPCConfig                 `yaml:"grpc,omitempty"`
+	Webserver            *WebserverConfig            `yaml:"webserver,omitempty"`
+	LogStderr            *bool                       `yaml:"log_stderr,omitempty"`
+	LogSyslog            *bool                       `yaml:"log_syslog,omitempty"`
+	LogLevel             string                      `yaml:"log_level,omitempty"`
+	LibsLogger           *LibsLoggerConfig           `yaml:"libs_logger,omitempty"`
+	OutputTimeout        *int                        `yaml:"output_timeout,omitempty"`
+	SyscallEventDrops    *SyscallEventDropsConfig    `yaml:"syscall_event_drops,omitempty"`
+	SyscallEventTimeouts *SyscallEventTimeoutsConfig `yaml:"syscall_event_timeouts,omitempty"`
+	Metrics              *MetricsConfig              `yaml:"metrics,omitempty"`
+	BaseSyscalls         *BaseSyscallsConfig         `yaml:"base_syscalls,omitempty"`
+	Extra                map[string]interface{}      `yaml:",inline"`
+}
+
+// RulesSelectionConfig is an entry of the `rules` config key, enabling
+// or disabling rules by name or tag.
+type RulesSelectionConfig struct {
+	Enable  *RulesMatchConfig `yaml:"enable,omitempty"`
+	Disable *RulesMatchConfig `yaml:"disable,omitempty"`
+}
+
+// RulesMatchConfig matches rules by name or tag, supporting wildcards.
+type RulesMatchConfig struct {
+	Rule string `yaml:"rule,omitempty"`
+	Tag  string `yaml:"tag,omitempty"`
+}
+
+// EngineConfig is the `engine` config key, selecting the event source
+// of the syscall event source and its parameters.
+type EngineConfig struct {
+	Kind       string              `yaml:"kind,omitempty"`
+	Kmod       *DriverEngineConfig `yaml:"kmod,omitempty"`
+	EBPF       *DriverEngineConfig `yaml:"ebpf,omitempty"`
+	ModernEBPF *DriverEngineConfig `yaml:"modern_ebpf,omitempty"`
+	Replay     *ReplayEngineConfig `yaml:"replay,omitempty"`
+	GVisor     *GVisorEngineConfig `yaml:"gvisor,omitempty"`
+}
+
+// DriverEngineConfig are the parameters of the kmod, ebpf, and modern_ebpf engines.
+type DriverEngineConfig struct {
+	// Probe is the path of the eBPF probe, only used by the ebpf engine
+	Probe string `yaml:"probe,omitempty"`
+	// CPUsForEachBuffer is only used by the modern_ebpf engine
+	CPUsForEachBuffer *int  `yaml:"cpus_for_each_buffer,omitempty"`
+	BufSizePreset     *int  `yaml:"buf_size_preset,omitempty"`
+	DropFailedExit    *bool `yaml:"drop_failed_exit,omitempty"`
+}
+
+// ReplayEngineConfig are the parameters of the replay engine.
+type ReplayEngineConfig struct {
+	CaptureFile string `yaml:"capture_file,omitempty"`
+}
+
+// GVisorEngineConfig are the parameters of the gvisor engine.
+type GVisorEngineConfig struct {
+	Config string `yaml:"config,omitempty"`
+	Root   string `yaml:"root,omitempty"`
+}
+
+// PluginConfig is an entry of the `plugins` config key. InitConfig can
+// either be a string or a yaml-serializable object.
+type PluginConfig struct {
+	Name        string      `yaml:"name"`
+	LibraryPath string      `yaml:"library_path"`
+	InitConfig  interface{} `yaml:"init_config,omitempty"`
+	OpenParams  string      `yaml:"open_params,omitempty"`
+}
+
+// OutputsQueueConfig is the `outputs_queue` config key.
+type OutputsQueueConfig struct {
+	Capacity *int `yaml:"capacity,omitempty"`
+}
+
+// AppendOutputConfig is an entry of the `append_output` config key.
+type AppendOutputConfig struct {
+	Match       *AppendOutputMatchConfig `yaml:"match,omitempty"`
+	ExtraOutput string                   `yaml:"extra_output,omitempty"`
+	ExtraFields []interface{}            `yaml:"extra_fields,omitempty"`
+}
+
+// AppendOutputMatchConfig selects the rules to which append_output applies.
+type AppendOutputMatchConfig struct {
+	Source string   `yaml:"source,omitempty"`
+	Rule   string   `yaml:"rule,omitempty"`
+	Tags   []string `yaml:"tags,omitempty"`
+}
+
+// EnabledConfig is a config key only supporting the `enabled` flag.
+type EnabledConfig struct {
+	Enabled *bool `yaml:"enabled,omitempty"`
+}
+
+// FileOutputConfig is the `file_output` config key.
+type FileOutputConfig struct {
+	Enabled   *bool  `yaml:"enabled,omitempty"`
+	KeepAlive *bool  `yaml:"keep_alive,omitempty"`
+	Filename  string `yaml:"filename,omitempty"`
+}
+
+// HTTPOutputConfig is the `http_output` config key.
+type HTTPOutputConfig struct {
+	Enabled         *bool  `yaml:"enabled,omitempty"`
+	URL             string `yaml:"url,omitempty"`
+	UserAgent       string `yaml:"user_agent,omitempty"`
+	Insecure        *bool  `yaml:"insecure,omitempty"`
+	CACert          string `yaml:"ca_cert,omitempty"`
+	CABundle        string `yaml:"ca_bundle,omitempty"`
+	CAPath          string `yaml:"ca_path,omitempty"`
+	MTLS            *bool  `yaml:"mtls,omitempty"`
+	ClientCert      string `yaml:"client_cert,omitempty"`
+	ClientKey       string `yaml:"client_key,omitempty"`
+	Echo            *bool  `yaml:"echo,omitempty"`
+	CompressUploads *bool  `yaml:"compress_uploads,omitempty"`
+	KeepAlive       *bool  `yaml:"keep_alive,omitempty"`
+}
+
+// ProgramOutputConfig is the `program_output` config key.
+type ProgramOutputConfig struct {
+	Enabled   *bool  `yaml:"enabled,omitempty"`
+	KeepAlive *bool  `yaml:"keep_alive,omitempty"`
+	Program   string `yaml:"program,omitempty"`
+}
+
+// GRPCConfig is the `grpc` config key.
+type GRPCConfig struct {
+	Enabled     *bool  `yaml:"enabled,omitempty"`
+	BindAddress string `yaml:"bind_address,omitempty"`
+	Threadiness *int   `yaml:"threadiness,omitempty"`
+}
+
+// WebserverConfig is the `webserver` config key.
+type WebserverConfig struct {
+	Enabled                  *bool  `yaml:"enabled,omitempty"`
+	Threadiness              *int   `yaml:"threadiness,omitempty"`
+	ListenPort               *int   `yaml:"listen_port,omitempty"`
+	ListenAddress            string `yaml:"listen_address,omitempty"`
+	K8sHealthzEndpoint       string `yaml:"k8s_healthz_endpoint,omitempty"`
+	PrometheusMetricsEnabled *bool  `yaml:"prometheus_metrics_enabled,omitempty"`
+	SSLEnabled               *bool  `yaml:"ssl_enabled,omitempty"`
+	SSLCertificate           string `yaml:"ssl_certificate,omitempty"`
+}
+
+// LibsLoggerConfig is the `libs_logger` config key.
+type LibsLoggerConfig struct {
+	Enabled  *bool  `yaml:"enabled,omitempty"`
+	Severity string `yaml:"severity,omitempty"`
+}
+
+// SyscallEventDropsConfig is the `syscall_event_drops` config key.
+type SyscallEventDropsConfig struct {
+	Threshold     *float64 `yaml:"threshold,omitempty"`
+	Actions       []string `yaml:"actions,omitempty"`
+	Rate          *float64 `yaml:"rate,omitempty"`
+	MaxBurst      *int     `yaml:"max_burst,omitempty"`
+	SimulateDrops *bool    `yaml:"simulate_drops,omitempty"`
+}
+
+// SyscallEventTimeoutsConfig is the `syscall_event_timeouts` config key.
+type SyscallEventTimeoutsConfig struct {
+	MaxConsecutives *int `yaml:"max_consecutives,omitempty"`
+}
+
+// MetricsConfig is the `metrics` config key.
+type MetricsConfig struct {
+	Enabled                    *bool  `yaml:"enabled,omitempty"`
+	Interval                   string `yaml:"interval,omitempty"`
+	OutputRule                 *bool  `yaml:"output_rule,omitempty"`
+	OutputFile                 string `yaml:"output_file,omitempty"`
+	RulesCountersEnabled       *bool  `yaml:"rules_counters_enabled,omitempty"`
+	ResourceUtilizationEnabled *bool  `yaml:"resource_utilization_enabled,omitempty"`
+	StateCountersEnabled       *bool  `yaml:"state_counters_enabled,omitempty"`
+	KernelEventCountersEnabled *bool  `yaml:"kernel_event_counters_enabled,omitempty"`
+	LibbpfStatsEnabled         *bool  `yaml:"libbpf_stats_enabled,omitempty"`
+	PluginsMetricsEnabled      *bool  `yaml:"plugins_metrics_enabled,omitempty"`
+	ConvertMemoryToMB          *bool  `yaml:"convert_memory_to_mb,omitempty"`
+	IncludeEmptyValues         *bool  `yaml:"include_empty_values,omitempty"`
+}
+
+// BaseSyscallsConfig is the `base_syscalls` config key.
+type BaseSyscallsConfig struct {
+	CustomSet []string `yaml:"custom_set,omitempty"`
+	Repair    *bool    `yaml:"repair,omitempty"`
+	All       *bool    `yaml:"all,omitempty"`
+}
+
+// Marshal encodes the configuration in YAML.
+func (c *Config) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FileAccessor returns a file with the given name containing the
+// configuration, which can be used with WithConfig.
+func (c *Config) FileAccessor(name string) (run.FileAccessor, error) {
+	content, err := c.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return run.NewBytesFileAccessor(name, content), nil
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/falcosecurity/testing/pkg/run"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigBuilder builds a Falco configuration file (i.e. falco.yaml) by
+// layering one or more configurations on top of each other, in the
+// order in which they are added. Layers are merged key by key: nested
+// objects are merged recursively, whereas lists and scalar values of
+// upper layers override the ones of lower layers.
+type ConfigBuilder struct {
+	layers []map[string]interface{}
+	err    error
+}
+
+// NewConfigBuilder creates a new ConfigBuilder with no layers.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+func (b *ConfigBuilder) addYAML(content []byte) *ConfigBuilder {
+	if b.err != nil {
+		return b
+	}
+	layer := make(map[string]interface{})
+	if err := yaml.Unmarshal(content, &layer); err != nil {
+		b.err = fmt.Errorf("can't parse config layer: %s", err.Error())
+		return b
+	}
+	b.layers = append(b.layers, layer)
+	return b
+}
+
+// WithDefaultConfig adds the content of the default Falco config file
+// (i.e. FalcoConfig) as a layer.
+func (b *ConfigBuilder) WithDefaultConfig() *ConfigBuilder {
+	return b.WithFile(run.NewLocalFileAccessor(DefaultConfigFile, FalcoConfig))
+}
+
+// WithFile adds the YAML content of the given file as a layer.
+func (b *ConfigBuilder) WithFile(f run.FileAccessor) *ConfigBuilder {
+	if b.err != nil {
+		return b
+	}
+	content, err := f.Content()
+	if err != nil {
+		b.err = fmt.Errorf("can't read config file '%s': %s", f.Name(), err.Error())
+		return b
+	}
+	return b.addYAML(content)
+}
+
+// WithYAML adds the given YAML string as a layer.
+func (b *ConfigBuilder) WithYAML(content string) *ConfigBuilder {
+	return b.addYAML([]byte(content))
+}
+
+// WithConfig adds the given typed configuration as a layer. Only the
+// non-nil fields of the configuration override the lower layers.
+func (b *ConfigBuilder) WithConfig(c *Config) *ConfigBuilder {
+	if b.err != nil {
+		return b
+	}
+	content, err := c.Marshal()
+	if err != nil {
+		b.err = err
+		return b
+	}
+	return b.addYAML(content)
+}
+
+// Set adds a layer setting a single value for the given key. Nested keys
+// are separated by dots, following the syntax of the `-o` Falco option
+// (e.g. "webserver.listen_port").
+func (b *ConfigBuilder) Set(key string, value interface{}) *ConfigBuilder {
+	if b.err != nil {
+		return b
+	}
+	if len(key) == 0 {
+		b.err = fmt.Errorf("config key must not be empty")
+		return b
+	}
+	parts := strings.Split(key, ".")
+	layer := map[string]interface{}{parts[len(parts)-1]: value}
+	for i := len(parts) - 2; i >= 0; i-- {
+		layer = map[string]interface{}{parts[i]: layer}
+	}
+	b.layers = append(b.layers, layer)
+	return b
+}
+
+// Map returns the merged configuration as a generic map.
+func (b *ConfigBuilder) Map() (map[string]interface{}, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	res := make(map[string]interface{})
+	for _, l := range b.layers {
+		mergeConfigMaps(res, l)
+	}
+	return res, nil
+}
+
+// Config returns the merged configuration as a typed model.
+func (b *ConfigBuilder) Config() (*Config, error) {
+	content, err := b.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	res := &Config{}
+	if err := yaml.Unmarshal(content, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Marshal encodes the merged configuration in YAML.
+func (b *ConfigBuilder) Marshal() ([]byte, error) {
+	m, err := b.Map()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(m)
+}
+
+// Build returns a file with the given name containing the merged
+// configuration, which can be used with WithConfig.
+func (b *ConfigBuilder) Build(name string) (run.FileAccessor, error) {
+	content, err := b.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return run.NewBytesFileAccessor(name, content), nil
+}
+
+func mergeConfigMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]interface{})
+		dstMap, dstOk := dst[k].(map[string]interface{})
+		if srcOk && dstOk {
+			mergeConfigMaps(dstMap, srcMap)
+			continue
+		}
+		if srcOk {
+			// copy nested maps so that layers are never modified
+			copied := make(map[string]interface{})
+			mergeConfigMaps(copied, srcMap)
+			v = copied
+		}
+		dst[k] = v
+	}
+}
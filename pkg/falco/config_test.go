@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/falcosecurity/testing/pkg/run"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigBuilder(t *testing.T) {
+	base := `
+stdout_output:
+  enabled: true
+webserver:
+  enabled: false
+  listen_port: 8765
+rules_files:
+  - /etc/falco/falco_rules.yaml
+  - /etc/falco/falco_rules.local.yaml
+`
+	b := NewConfigBuilder().
+		WithYAML(base).
+		WithConfig(&Config{
+			JSONOutput: Ptr(true),
+			RulesFiles: []string{"rules.yaml"},
+			Webserver:  &WebserverConfig{Enabled: Ptr(true)},
+			Engine:     &EngineConfig{Kind: "nodriver"},
+			Extra:      map[string]interface{}{"some_key": "some_value"},
+		}).
+		Set("webserver.listen_port", 1234).
+		Set("metrics.interval", "2s")
+
+	m, err := b.Map()
+	require.Nil(t, err)
+	require.Equal(t, "some_value", m["some_key"])
+
+	c, err := b.Config()
+	require.Nil(t, err)
+	require.True(t, *c.StdoutOutput.Enabled)
+	require.True(t, *c.JSONOutput)
+	require.True(t, *c.Webserver.Enabled)
+	require.Equal(t, 1234, *c.Webserver.ListenPort)
+	require.Equal(t, []string{"rules.yaml"}, c.RulesFiles)
+	require.Equal(t, "nodriver", c.Engine.Kind)
+	require.Equal(t, "2s", c.Metrics.Interval)
+	require.Nil(t, c.GRPC)
+
+	f, err := b.Build("falco.yaml")
+	require.Nil(t, err)
+	require.Equal(t, "falco.yaml", f.Name())
+	content, err := f.Content()
+	require.Nil(t, err)
+	require.Contains(t, string(content), "listen_port: 1234")
+
+	_, err = NewConfigBuilder().WithYAML("key: [").Build("falco.yaml")
+	require.Error(t, err)
+}
+
+func TestConfigMarshal(t *testing.T) {
+	c := &Config{StdoutOutput: &EnabledConfig{Enabled: Ptr(false)}}
+	content, err := c.Marshal()
+	require.Nil(t, err)
+	require.Equal(t, "stdout_output:\n  enabled: false\n", string(content))
+}
+
+func TestNewPluginConfig(t *testing.T) {
+	base := run.NewStringFileAccessor("falco.yaml", `
+json_output: true
+plugins:
+  - name: json
+    library_path: libjson.so
+  - name: dummy
+    library_path: libdummy-old.so
+load_plugins: [json]
+`)
+	f, err := NewPluginConfigWithBase("plugin-config.yaml", base,
+		&PluginConfigInfo{
+			Name:       "dummy",
+			Library:    "libdummy.so",
+			OpenParams: `{"start": 1, "maxEvents": 20}`,
+			InitConfig: map[string]interface{}{"jitter": 10, "nested": map[string]interface{}{"key": "a: 'b'\nc"}},
+		},
+	)
+	require.Nil(t, err)
+	content, err := f.Content()
+	require.Nil(t, err)
+	c, err := NewConfigBuilder().WithYAML(string(content)).Config()
+	require.Nil(t, err)
+	require.True(t, *c.JSONOutput)
+	require.Contains(t, c.LoadPlugins, "dummy")
+	require.NotContains(t, c.LoadPlugins, "json")
+	require.Nil(t, ValidatePluginsConfig(c))
+
+	plugins := make(map[string]PluginConfig)
+	for _, p := range c.Plugins {
+		plugins[p.Name] = p
+	}
+	require.Equal(t, "libjson.so", plugins["json"].LibraryPath)
+	require.Equal(t, "libdummy.so", plugins["dummy"].LibraryPath)
+	require.Equal(t, `{"start": 1, "maxEvents": 20}`, plugins["dummy"].OpenParams)
+	initConfig, ok := plugins["dummy"].InitConfig.(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, 10, initConfig["jitter"])
+	require.Equal(t, "a: 'b'\nc", initConfig["nested"].(map[string]interface{})["key"])
+
+	_, err = NewPluginConfig("plugin-config.yaml",
+		&PluginConfigInfo{Name: "dummy", Library: "libdummy.so"},
+		&PluginConfigInfo{Name: "dummy", Library: "libdummy.so"},
+	)
+	require.Error(t, err)
+	_, err = NewPluginConfig("plugin-config.yaml", &PluginConfigInfo{Name: "dummy"})
+	require.Error(t, err)
+	require.Error(t, ValidatePluginsConfig(&Config{LoadPlugins: []string{"missing"}}))
+
+	// the container plugin is enforced only if installed and not declared
+	library := filepath.Join(t.TempDir(), "libcontainer.so")
+	dummy := &PluginConfigInfo{Name: "dummy", Library: "libdummy.so"}
+	require.Len(t, withContainerPlugin([]*PluginConfigInfo{dummy}, library), 1)
+	require.Nil(t, os.WriteFile(library, nil, 0644))
+	enforced := withContainerPlugin([]*PluginConfigInfo{dummy}, library)
+	require.Len(t, enforced, 2)
+	require.Equal(t, library, enforced[1].Library)
+	container := &PluginConfigInfo{Name: "container", Library: "libother.so"}
+	enforced = withContainerPlugin([]*PluginConfigInfo{dummy, container}, library)
+	require.Len(t, enforced, 2)
+	require.Equal(t, "libother.so", enforced[1].Library)
+}
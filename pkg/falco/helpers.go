@@ -19,17 +19,16 @@ limitations under the License.
 package falco
 
 import (
-	"bytes"
-	"encoding/json"
+	"fmt"
 	"os"
-	"text/template"
 
 	"github.com/falcosecurity/testing/pkg/run"
 )
 
 // PluginConfigInfo represents the info about a single plugin
 // in a Falco configuration file (i.e. falco.yaml). InitConfig can
-// be either a string or a json-serializable object.
+// be either a string or a yaml-serializable object, which is rendered
+// as a nested object in the configuration.
 type PluginConfigInfo struct {
 	Name       string
 	Library    string
@@ -37,49 +36,107 @@ type PluginConfigInfo struct {
 	InitConfig interface{}
 }
 
-//lint:ignore U1000 this receiver is invoked in a tamplete and is not actually unused
-func (p *PluginConfigInfo) initConfigString() string {
-	if p.InitConfig == nil {
-		return ""
+func (p *PluginConfigInfo) pluginConfig() PluginConfig {
+	return PluginConfig{
+		Name:        p.Name,
+		LibraryPath: p.Library,
+		InitConfig:  p.InitConfig,
+		OpenParams:  p.OpenParams,
 	}
-	if str, ok := p.InitConfig.(string); ok {
-		return str
-	}
-	str, err := json.Marshal(p.InitConfig)
-	if err != nil {
-		panic("PluginConfigInfo is neither a string or a json-serializable object: " + err.Error())
-	}
-	return string(str)
 }
 
 // NewPluginConfig helps creating valid Falco configuration files
 // (i.e. falco.yaml) loading one or more plugins.
 func NewPluginConfig(configName string, plugins ...*PluginConfigInfo) (run.FileAccessor, error) {
-	var buf bytes.Buffer
-
-	// If we are running a newer Falco version with
-	// the container plugin, enforce it to the
-	if _, err := os.Stat(FalcoContainerPluginLibrary); err == nil {
-		plugins = append(plugins, &PluginConfigInfo{
-			Name:    "container",
-			Library: FalcoContainerPluginLibrary,
-		})
+	return NewPluginConfigWithBase(configName, nil, plugins...)
+}
+
+// NewPluginConfigWithBase helps creating valid Falco configuration files
+// (i.e. falco.yaml) loading one or more plugins, by merging them with the
+// content of an existing configuration file. The plugins declared in the
+// base file are preserved, unless redeclared with the same name, and only
+// the given plugins are loaded. The base file is ignored if nil.
+func NewPluginConfigWithBase(configName string, base run.FileAccessor, plugins ...*PluginConfigInfo) (run.FileAccessor, error) {
+	builder := NewConfigBuilder()
+	if base != nil {
+		builder.WithFile(base)
+	}
+	baseConfig, err := builder.Config()
+	if err != nil {
+		return nil, err
 	}
 
-	err := template.Must(template.New("").Parse(`
-stdout_output:
-  enabled: true
-plugins:
-{{ range $i, $p := . }}  - name: {{ $p.Name }}
-    library_path: {{ $p.Library }}{{ if $p.InitConfig }}
-    init_config: {{ call $p.initConfigString }}{{ end }}{{ if $p.OpenParams }}
-    open_params: {{ $p.OpenParams }}{{ end }}
-{{ end }}load_plugins:{{ range $i, $p := . }}
-  - {{ $p.Name }}
-{{ end }}
-`)).Execute(&buf, plugins)
+	plugins = withContainerPlugin(plugins, FalcoContainerPluginLibrary)
+
+	config := &Config{
+		StdoutOutput: &EnabledConfig{Enabled: Ptr(true)},
+		LoadPlugins:  []string{},
+	}
+	declared := make(map[string]bool)
+	for _, p := range plugins {
+		if declared[p.Name] {
+			return nil, fmt.Errorf("plugin '%s' is declared more than once", p.Name)
+		}
+		declared[p.Name] = true
+		config.Plugins = append(config.Plugins, p.pluginConfig())
+		config.LoadPlugins = append(config.LoadPlugins, p.Name)
+	}
+	for _, p := range baseConfig.Plugins {
+		if !declared[p.Name] {
+			config.Plugins = append(config.Plugins, p)
+		}
+	}
+
+	merged, err := builder.WithConfig(config).Set("load_plugins", config.LoadPlugins).Config()
 	if err != nil {
 		return nil, err
 	}
-	return run.NewStringFileAccessor(configName, buf.String()), err
+	if err := ValidatePluginsConfig(merged); err != nil {
+		return nil, err
+	}
+	return builder.Build(configName)
+}
+
+// withContainerPlugin enforces the container plugin with the given library
+// if it's installed, as required by newer Falco versions, unless the plugin
+// is already declared.
+func withContainerPlugin(plugins []*PluginConfigInfo, library string) []*PluginConfigInfo {
+	for _, p := range plugins {
+		if p.Name == "container" {
+			return plugins
+		}
+	}
+	if _, err := os.Stat(library); err != nil {
+		return plugins
+	}
+	return append(plugins, &PluginConfigInfo{
+		Name:    "container",
+		Library: library,
+	})
+}
+
+// ValidatePluginsConfig returns a non-nil error if the plugins of the given
+// Falco configuration are not valid, such as when load_plugins refers to
+// plugins not declared in plugins, or when plugins are declared without
+// a name or a library path.
+func ValidatePluginsConfig(c *Config) error {
+	declared := make(map[string]bool)
+	for i, p := range c.Plugins {
+		if len(p.Name) == 0 {
+			return fmt.Errorf("plugin at index %d has no name", i)
+		}
+		if len(p.LibraryPath) == 0 {
+			return fmt.Errorf("plugin '%s' has no library path", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("plugin '%s' is declared more than once", p.Name)
+		}
+		declared[p.Name] = true
+	}
+	for _, name := range c.LoadPlugins {
+		if !declared[name] {
+			return fmt.Errorf("load_plugins refers to plugin '%s', which is not declared", name)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPRequest is a request received by an HTTPReceiver.
+type HTTPRequest struct {
+	// Time is the instant in which the request was received
+	Time        time.Time
+	Method      string
+	Path        string
+	Header      http.Header
+	ContentType string
+	Body        []byte
+	//
+	// StatusCode is the status code with which the request was replied
+	StatusCode int
+	//
+	// Delay is the delay applied before replying to the request
+	Delay time.Duration
+}
+
+// HTTPResponse describes how an HTTPReceiver replies to a request.
+// A zero StatusCode means 200.
+type HTTPResponse struct {
+	StatusCode int
+	Delay      time.Duration
+}
+
+// HTTPResponder returns the response to the n-th request received by an
+// HTTPReceiver, starting from zero. Responders are invoked concurrently
+// for concurrent requests, and may inspect the receiver.
+type HTTPResponder func(n int, req *HTTPRequest) HTTPResponse
+
+// HTTPReceiverOption is an option for creating an HTTPReceiver
+type HTTPReceiverOption func(*HTTPReceiver)
+
+// HTTPReceiver is a local HTTP server recording the requests it receives,
+// such as the ones posted by the Falco http_output.
+type HTTPReceiver struct {
+	m         sync.Mutex
+	listener  net.Listener
+	server    *http.Server
+	responder HTTPResponder
+	requests  []*HTTPRequest
+}
+
+// WithHTTPResponseCode replies to all requests with the given status code.
+func WithHTTPResponseCode(code int) HTTPReceiverOption {
+	return func(r *HTTPReceiver) {
+		prev := r.responder
+		r.responder = func(n int, req *HTTPRequest) HTTPResponse {
+			res := prev(n, req)
+			res.StatusCode = code
+			return res
+		}
+	}
+}
+
+// WithHTTPResponseDelay replies to all requests after the given delay.
+func WithHTTPResponseDelay(delay time.Duration) HTTPReceiverOption {
+	return func(r *HTTPReceiver) {
+		prev := r.responder
+		r.responder = func(n int, req *HTTPRequest) HTTPResponse {
+			res := prev(n, req)
+			res.Delay = delay
+			return res
+		}
+	}
+}
+
+// WithHTTPResponder replies to each request with the response returned
+// by the given function, such as to fail only the first requests.
+func WithHTTPResponder(f HTTPResponder) HTTPReceiverOption {
+	return func(r *HTTPReceiver) { r.responder = f }
+}
+
+// NewHTTPReceiver starts a new HTTP receiver listening on a random port
+// of the loopback interface. By default, all requests are replied
+// immediately with status 200.
+func NewHTTPReceiver(options ...HTTPReceiverOption) (*HTTPReceiver, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &HTTPReceiver{
+		listener: l,
+		responder: func(int, *HTTPRequest) HTTPResponse {
+			return HTTPResponse{StatusCode: http.StatusOK}
+		},
+	}
+	for _, o := range options {
+		o(r)
+	}
+	r.server = &http.Server{Handler: http.HandlerFunc(r.handle)}
+	go func() { _ = r.server.Serve(l) }()
+	return r, nil
+}
+
+// URL returns the URL on which the receiver accepts requests.
+func (r *HTTPReceiver) URL() string {
+	return "http://" + r.listener.Addr().String() + "/"
+}
+
+// Requests returns all the requests received so far, in order of arrival.
+func (r *HTTPReceiver) Requests() []*HTTPRequest {
+	r.m.Lock()
+	defer r.m.Unlock()
+	res := make([]*HTTPRequest, len(r.requests))
+	copy(res, r.requests)
+	return res
+}
+
+// Detections converts the bodies of all the requests received so far into
+// a list of rule detections, either in JSON or text format.
+func (r *HTTPReceiver) Detections() Detections {
+	var res Detections
+	for _, req := range r.Requests() {
+		d, err := ParseDetections(string(req.Body))
+		if err == nil {
+			res = append(res, d...)
+		}
+	}
+	return res
+}
+
+// Name returns the name of the Falco output channel of the receiver.
+func (r *HTTPReceiver) Name() string {
+	return "http_output"
+}
+
+// Config returns the config overrides enabling the Falco http_output
+// towards the receiver.
+func (r *HTTPReceiver) Config() []ConfigOverride {
+	return []ConfigOverride{
+		{Key: "http_output.enabled", Value: "true"},
+		{Key: "http_output.url", Value: r.URL()},
+	}
+}
+
+// Close stops the receiver, by interrupting all the pending requests.
+func (r *HTTPReceiver) Close() error {
+	return r.server.Close()
+}
+
+func (r *HTTPReceiver) handle(w http.ResponseWriter, httpReq *http.Request) {
+	req := &HTTPRequest{
+		Time:        time.Now(),
+		Method:      httpReq.Method,
+		Path:        httpReq.URL.Path,
+		Header:      httpReq.Header.Clone(),
+		ContentType: httpReq.Header.Get("Content-Type"),
+	}
+	req.Body, _ = io.ReadAll(httpReq.Body)
+
+	r.m.Lock()
+	n := len(r.requests)
+	r.requests = append(r.requests, req)
+	r.m.Unlock()
+
+	// note: the responder is invoked without holding the lock, so that
+	// it can inspect the receiver (e.g. with Requests)
+	res := r.responder(n, req)
+	if res.StatusCode == 0 {
+		res.StatusCode = http.StatusOK
+	}
+	r.m.Lock()
+	req.StatusCode = res.StatusCode
+	req.Delay = res.Delay
+	r.m.Unlock()
+
+	if res.Delay > 0 {
+		ctx, cancel := context.WithTimeout(httpReq.Context(), res.Delay)
+		defer cancel()
+		<-ctx.Done()
+	}
+	w.WriteHeader(res.StatusCode)
+}
+
+// WithHTTPOutput runs Falco by enabling its http_output towards an
+// HTTPReceiver started for the run and stopped once Falco terminates
+// (see TestOutput.HTTPOutput). The receiver listens on the loopback
+// interface, so this requires the runner to share the network with
+// the Falco process.
+func WithHTTPOutput(options ...HTTPReceiverOption) TestOption {
+	return func(o *testOptions) {
+		o.httpOutput = true
+		o.httpOutputOpts = append(o.httpOutputOpts, options...)
+	}
+}
+
+// HTTPOutput returns the receiver of the Falco http_output, which can be
+// inspected after the run. Returns nil if Falco wasn't run with
+// WithHTTPOutput.
+func (t *TestOutput) HTTPOutput() *HTTPReceiver {
+	return t.httpReceiver
+}
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/testing/pkg/run"
+)
+
+// OutputSink is the destination of one of the Falco output channels. Each
+// sink knows the config enabling its channel and collects the alerts sent
+// to it as Detections, so that all channels can be asserted in the same way.
+type OutputSink interface {
+	// Name returns the name of the Falco output channel, such as "file_output".
+	Name() string
+	//
+	// Config returns the config overrides enabling the output channel
+	// towards the sink.
+	Config() []ConfigOverride
+	//
+	// Detections returns the alerts collected by the sink so far.
+	Detections() Detections
+	//
+	// Close stops the sink and releases its resources. The alerts already
+	// sent to the sink are collected before closing it, and remain
+	// available afterwards. Closing a sink more than once has no effect.
+	Close() error
+}
+
+const (
+	fileOutputSinkName    = "file_output"
+	programOutputSinkName = "program_output"
+)
+
+// FileSink is an OutputSink collecting the alerts written to a file in the
+// working directory of the runner, either directly by the Falco file_output
+// or by the collector program of the program_output. The file is collected
+// from the runner once Falco terminates, which requires the runner to
+// support it (see run.CollectsFiles).
+type FileSink struct {
+	m       sync.Mutex
+	name    string
+	path    string
+	config  func(path string) []ConfigOverride
+	content []byte
+	err     error
+}
+
+// runnerSink is an OutputSink whose alerts are written in the environment
+// of the runner, and need to be collected from it.
+type runnerSink interface {
+	OutputSink
+	collect(path string) run.RunnerOption
+}
+
+// NewFileOutputSink creates a sink for the Falco file_output, which writes
+// the alerts to a new file.
+func NewFileOutputSink() (*FileSink, error) {
+	s := newFileSink(fileOutputSinkName)
+	s.config = func(path string) []ConfigOverride {
+		return []ConfigOverride{
+			{Key: "file_output.enabled", Value: "true"},
+			{Key: "file_output.keep_alive", Value: "false"},
+			{Key: "file_output.filename", Value: path},
+		}
+	}
+	return s, nil
+}
+
+// ProgramSinkOption is an option for creating a program_output sink
+type ProgramSinkOption func(*programSinkOptions)
+
+type programSinkOptions struct {
+	delay    time.Duration
+	exitCode int
+}
+
+// WithProgramDelay makes the collector program wait for the given duration
+// before reading each alert, which simulates a slow output channel.
+func WithProgramDelay(delay time.Duration) ProgramSinkOption {
+	return func(o *programSinkOptions) {
+		o.delay = delay
+	}
+}
+
+// WithProgramExitCode makes the collector program print an error on stderr
+// and exit with the given code after reading each alert, which simulates
+// a failing output channel.
+func WithProgramExitCode(code int) ProgramSinkOption {
+	return func(o *programSinkOptions) {
+		o.exitCode = code
+	}
+}
+
+// NewProgramOutputSink creates a sink for the Falco program_output, which
+// spawns a collector program appending each alert to a new file.
+func NewProgramOutputSink(options ...ProgramSinkOption) (*FileSink, error) {
+	opts := &programSinkOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+	s := newFileSink(programOutputSinkName)
+	s.config = func(path string) []ConfigOverride {
+		program := "cat >> '" + path + "'"
+		if opts.delay > 0 {
+			program = "sleep " + strconv.FormatFloat(opts.delay.Seconds(), 'f', -1, 64) + "; " + program
+		}
+		if opts.exitCode != 0 {
+			program += fmt.Sprintf("; echo 'program_output sink failure' >&2; exit %d", opts.exitCode)
+		}
+		return []ConfigOverride{
+			{Key: "program_output.enabled", Value: "true"},
+			{Key: "program_output.keep_alive", Value: "false"},
+			{Key: "program_output.program", Value: program},
+		}
+	}
+	return s, nil
+}
+
+func newFileSink(name string) *FileSink {
+	return &FileSink{name: name}
+}
+
+// Name returns the name of the Falco output channel of the sink.
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+// Path returns the path of the file to which the alerts are written, in
+// the working directory of the runner. The path is assigned once the sink
+// is used in a run, and is empty before.
+func (s *FileSink) Path() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.path
+}
+
+// Config returns the config overrides enabling the output channel
+// towards the sink.
+func (s *FileSink) Config() []ConfigOverride {
+	return s.config(s.Path())
+}
+
+// Content returns the content of the file collected from the runner once
+// Falco terminated. A missing file is considered empty, as Falco creates
+// it only when the first alert is written.
+func (s *FileSink) Content() ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.content, s.err
+}
+
+func (s *FileSink) collect(path string) run.RunnerOption {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.path = path
+	s.content, s.err = nil, nil
+	return run.WithCollectedFile(path, func(content []byte, err error) {
+		s.m.Lock()
+		defer s.m.Unlock()
+		if os.IsNotExist(err) {
+			content, err = nil, nil
+		}
+		s.content, s.err = content, err
+	})
+}
+
+// Detections parses the content of the file collected from the runner into
+// a list of rule detections, either in JSON or text format.
+func (s *FileSink) Detections() Detections {
+	content, err := s.Content()
+	if err != nil {
+		return nil
+	}
+	res, _ := ParseDetections(string(content))
+	return res
+}
+
+// Close has no effect, as the file is collected once Falco terminates and
+// gets removed along with the working directory of the runner.
+func (s *FileSink) Close() error {
+	return nil
+}
+
+// WithOutputSinks runs Falco by enabling the output channels of all the
+// given sinks. The sinks are closed once Falco terminates, and can be
+// inspected after the run either directly or through TestOutput.OutputSink.
+func WithOutputSinks(sinks ...OutputSink) TestOption {
+	return func(o *testOptions) {
+		o.outputSinks = append(o.outputSinks, sinks...)
+	}
+}
+
+// WithFileOutput runs Falco by enabling its file_output towards a
+// FileSink created for the run (see TestOutput.OutputSink).
+func WithFileOutput() TestOption {
+	return func(o *testOptions) {
+		o.fileOutput = true
+	}
+}
+
+// WithProgramOutput runs Falco by enabling its program_output towards a
+// FileSink created for the run (see TestOutput.OutputSink).
+func WithProgramOutput(options ...ProgramSinkOption) TestOption {
+	return func(o *testOptions) {
+		o.programOutput = true
+		o.programOutputOpts = append(o.programOutputOpts, options...)
+	}
+}
+
+// OutputSinks returns all the sinks of the output channels enabled for the
+// run, including the receivers of WithHTTPOutput and WithSyslogOutput.
+func (t *TestOutput) OutputSinks() []OutputSink {
+	return append([]OutputSink{}, t.sinks...)
+}
+
+// OutputSink returns the last sink of the output channel with the given
+// name enabled for the run, such as "file_output". Returns nil if there
+// is none.
+func (t *TestOutput) OutputSink(name string) OutputSink {
+	for i := len(t.sinks) - 1; i >= 0; i-- {
+		if t.sinks[i].Name() == name {
+			return t.sinks[i]
+		}
+	}
+	return nil
+}
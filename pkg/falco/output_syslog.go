@@ -0,0 +1,386 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	// DefaultSyslogSocket is the unix socket to which the C library sends
+	// syslog messages, which is the one used by the Falco syslog_output
+	DefaultSyslogSocket = "/dev/log"
+	//
+	// SyslogFormatRFC3164 is the BSD syslog message format
+	SyslogFormatRFC3164 = "rfc3164"
+	//
+	// SyslogFormatRFC5424 is the IETF syslog message format
+	SyslogFormatRFC5424 = "rfc5424"
+)
+
+// syslogDrainTimeout is the time given to a SyslogReceiver to collect the
+// messages already sent to it when closing it
+const syslogDrainTimeout = 100 * time.Millisecond
+
+// SyslogMessage is a syslog message received by a SyslogReceiver.
+type SyslogMessage struct {
+	// Format is either SyslogFormatRFC3164 or SyslogFormatRFC5424
+	Format   string
+	Facility int
+	Severity int
+	//
+	// Time is the timestamp of the message, which is zero if absent.
+	// RFC3164 timestamps carry no year, so the current one is assumed.
+	Time     time.Time
+	Hostname string
+	//
+	// Tag is the name of the application that sent the message
+	Tag     string
+	PID     string
+	MsgID   string
+	Message string
+	Raw     string
+}
+
+// Priority returns the Falco priority matching the severity of the message.
+func (m *SyslogMessage) Priority() Priority {
+	if m.Severity < 0 || m.Severity > 7 {
+		return PriorityUnknown
+	}
+	return PriorityEmergency - Priority(m.Severity)
+}
+
+// Alert converts the message into an alert. The message is parsed either
+// in JSON or in text format, and if that fails the alert is made of the
+// message, its priority, its time, and its hostname.
+func (m *SyslogMessage) Alert() *Alert {
+	if alert, err := parseAlert(m.Message); err == nil {
+		if alert.Priority == PriorityUnknown {
+			alert.Priority = m.Priority()
+		}
+		return alert
+	}
+	return &Alert{
+		Time:     m.Time,
+		Priority: m.Priority(),
+		Hostname: m.Hostname,
+		Output:   m.Message,
+	}
+}
+
+// ParseSyslogMessage parses a syslog message either in the RFC3164 or in
+// the RFC5424 format. For RFC3164, the hostname is optional, as the C
+// library omits it when sending messages to the local syslog socket.
+func ParseSyslogMessage(raw string) (*SyslogMessage, error) {
+	raw = strings.TrimRight(raw, "\x00\r\n")
+	m := &SyslogMessage{Raw: raw}
+	if !strings.HasPrefix(raw, "<") {
+		return nil, fmt.Errorf("syslog message without priority: %s", raw)
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 0 {
+		return nil, fmt.Errorf("syslog message with malformed priority: %s", raw)
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("syslog message with malformed priority: %s", raw)
+	}
+	m.Facility = pri / 8
+	m.Severity = pri % 8
+	rest := raw[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		m.Format = SyslogFormatRFC5424
+		return m, m.parseRFC5424(rest[2:])
+	}
+	m.Format = SyslogFormatRFC3164
+	return m, m.parseRFC3164(rest)
+}
+
+func (m *SyslogMessage) parseRFC3164(s string) error {
+	const layout = time.Stamp
+	if len(s) >= len(layout) {
+		if t, err := time.ParseInLocation(layout, s[:len(layout)], time.Local); err == nil {
+			m.Time = t.AddDate(time.Now().Year(), 0, 0)
+			s = strings.TrimPrefix(s[len(layout):], " ")
+		}
+	}
+	// the tag is terminated by either a colon or a bracket with the pid,
+	// and is optionally preceded by the hostname
+	token, after, _ := strings.Cut(s, " ")
+	if !strings.HasSuffix(token, ":") && !strings.HasSuffix(token, "]") && len(after) > 0 {
+		next, _, _ := strings.Cut(after, " ")
+		if strings.HasSuffix(next, ":") || strings.HasSuffix(next, "]:") {
+			m.Hostname = token
+			s = after
+		}
+	}
+	tag, msg, found := strings.Cut(s, ": ")
+	if !found || strings.Contains(tag, " ") {
+		m.Message = s
+		return nil
+	}
+	if i := strings.IndexByte(tag, '['); i >= 0 && strings.HasSuffix(tag, "]") {
+		m.PID = tag[i+1 : len(tag)-1]
+		tag = tag[:i]
+	}
+	m.Tag = tag
+	m.Message = msg
+	return nil
+}
+
+func (m *SyslogMessage) parseRFC5424(s string) error {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 5 {
+		return fmt.Errorf("malformed rfc5424 syslog message: %s", m.Raw)
+	}
+	nilValue := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	if ts := nilValue(fields[0]); len(ts) > 0 {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return err
+		}
+		m.Time = t
+	}
+	m.Hostname = nilValue(fields[1])
+	m.Tag = nilValue(fields[2])
+	m.PID = nilValue(fields[3])
+	m.MsgID = nilValue(fields[4])
+	if len(fields) < 6 {
+		return nil
+	}
+	msg, err := skipStructuredData(fields[5])
+	if err != nil {
+		return fmt.Errorf("malformed rfc5424 syslog message: %s", m.Raw)
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(msg, " "), "\ufeff")
+	return nil
+}
+
+// skipStructuredData returns what follows the structured data of an
+// RFC5424 message, which is either nil or a sequence of bracketed elements.
+func skipStructuredData(s string) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], nil
+	}
+	for strings.HasPrefix(s, "[") {
+		escaped, closed := false, false
+		for i := 1; i < len(s); i++ {
+			switch {
+			case escaped:
+				escaped = false
+			case s[i] == '\\':
+				escaped = true
+			case s[i] == ']':
+				s, closed = s[i+1:], true
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed {
+			return "", errors.New("unterminated structured data")
+		}
+	}
+	return s, nil
+}
+
+// SyslogReceiver is a syslog server recording the messages it receives,
+// either on a unix datagram socket or on a UDP port.
+type SyslogReceiver struct {
+	m        sync.Mutex
+	conn     net.PacketConn
+	network  string
+	address  string
+	cleanup  func()
+	messages []*SyslogMessage
+	errs     []error
+	done     chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewSyslogReceiver starts a new syslog receiver. The network is either
+// "unixgram" or "udp". If the address is empty, the receiver listens on
+// a new socket in a temporary directory or on a random port of the
+// loopback interface, respectively.
+func NewSyslogReceiver(network, address string) (*SyslogReceiver, error) {
+	r := &SyslogReceiver{network: network, done: make(chan struct{}), cleanup: func() {}}
+	switch network {
+	case "unixgram":
+		if len(address) == 0 {
+			dir, err := os.MkdirTemp("", "falcosecurity-testing-syslog-")
+			if err != nil {
+				return nil, err
+			}
+			address = filepath.Join(dir, "log.sock")
+			r.cleanup = func() { os.RemoveAll(dir) }
+		} else {
+			r.cleanup = func() { os.Remove(address) }
+		}
+	case "udp":
+		if len(address) == 0 {
+			address = "127.0.0.1:0"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %s", network)
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		r.cleanup()
+		return nil, err
+	}
+	if network == "unixgram" {
+		// any process must be able to send to the socket
+		if err := os.Chmod(address, 0666); err != nil {
+			conn.Close()
+			r.cleanup()
+			return nil, err
+		}
+	}
+	r.conn = conn
+	r.address = conn.LocalAddr().String()
+	go r.serve()
+	return r, nil
+}
+
+// Network returns the network on which the receiver listens.
+func (r *SyslogReceiver) Network() string {
+	return r.network
+}
+
+// Address returns the address on which the receiver listens, which is
+// either a unix socket path or an IP address and port.
+func (r *SyslogReceiver) Address() string {
+	return r.address
+}
+
+// Messages returns all the messages received so far, in order of arrival.
+func (r *SyslogReceiver) Messages() []*SyslogMessage {
+	r.m.Lock()
+	defer r.m.Unlock()
+	res := make([]*SyslogMessage, len(r.messages))
+	copy(res, r.messages)
+	return res
+}
+
+// Errors returns the errors occurred when parsing the received messages.
+func (r *SyslogReceiver) Errors() []error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]error{}, r.errs...)
+}
+
+// Detections converts all the messages received so far into a list of
+// rule detections (see SyslogMessage.Alert).
+func (r *SyslogReceiver) Detections() Detections {
+	var res Detections
+	for _, m := range r.Messages() {
+		res = append(res, m.Alert())
+	}
+	return res
+}
+
+// Name returns the name of the Falco output channel of the receiver.
+func (r *SyslogReceiver) Name() string {
+	return "syslog_output"
+}
+
+// Config returns the config overrides enabling the Falco syslog_output.
+func (r *SyslogReceiver) Config() []ConfigOverride {
+	return []ConfigOverride{{Key: "syslog_output.enabled", Value: "true"}}
+}
+
+// Close stops the receiver and removes its socket, if any. The messages
+// already sent to the receiver are collected before closing it.
+func (r *SyslogReceiver) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.conn.SetReadDeadline(time.Now().Add(syslogDrainTimeout))
+		<-r.done
+		err = multierr.Append(err, r.conn.Close())
+		r.cleanup()
+	})
+	return err
+}
+
+func (r *SyslogReceiver) serve() {
+	defer close(r.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m, err := ParseSyslogMessage(string(buf[:n]))
+		r.m.Lock()
+		if err != nil {
+			r.errs = append(r.errs, err)
+		} else {
+			r.messages = append(r.messages, m)
+		}
+		r.m.Unlock()
+	}
+}
+
+// WithSyslogOutput runs Falco by enabling its syslog_output and by
+// collecting its messages with a SyslogReceiver started for the run and
+// stopped once Falco terminates (see TestOutput.SyslogOutput). See
+// NewSyslogReceiver for the meaning of network and address. Since Falco
+// sends its messages to DefaultSyslogSocket through the C library, the
+// receiver needs to listen on it to collect them, which is possible only
+// if no other syslog daemon does. Other addresses are useful when Falco
+// runs in an environment in which that socket is mapped elsewhere, such
+// as a container. Falco can't send its messages over the network, so
+// the only supported network is "unixgram" and the run fails otherwise.
+func WithSyslogOutput(network, address string) TestOption {
+	return func(o *testOptions) {
+		if network != "unixgram" {
+			o.err = multierr.Append(o.err, fmt.Errorf("syslog output requires the unixgram network, not '%s'", network))
+			return
+		}
+		o.syslogOutput = &syslogOutputOptions{network: network, address: address}
+	}
+}
+
+type syslogOutputOptions struct {
+	network string
+	address string
+}
+
+// SyslogOutput returns the receiver of the Falco syslog_output, which can be
+// inspected after the run. Returns nil if Falco wasn't run with
+// WithSyslogOutput.
+func (t *TestOutput) SyslogOutput() *SyslogReceiver {
+	return t.syslogReceiver
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Priority is the priority of a Falco rule and of the alerts it produces.
+// Priorities are ordered by severity, so that a more severe priority
+// compares as greater than a less severe one. The zero value is
+// PriorityUnknown.
+type Priority int
+
+const (
+	// PriorityUnknown is an unset or unrecognized priority
+	PriorityUnknown Priority = iota
+	PriorityDebug
+	PriorityInformational
+	PriorityNotice
+	PriorityWarning
+	PriorityError
+	PriorityCritical
+	PriorityAlert
+	PriorityEmergency
+)
+
+var priorityNames = map[Priority]string{
+	PriorityDebug:         "Debug",
+	PriorityInformational: "Informational",
+	PriorityNotice:        "Notice",
+	PriorityWarning:       "Warning",
+	PriorityError:         "Error",
+	PriorityCritical:      "Critical",
+	PriorityAlert:         "Alert",
+	PriorityEmergency:     "Emergency",
+}
+
+// priorityAliases are the alternative names of priorities, including
+// the ones used in the past by Falco and the syslog abbreviations
+var priorityAliases = map[string]Priority{
+	"info":  PriorityInformational,
+	"warn":  PriorityWarning,
+	"err":   PriorityError,
+	"crit":  PriorityCritical,
+	"emerg": PriorityEmergency,
+}
+
+// ParsePriority parses a priority from its name or one of its aliases
+// (e.g. "info" for Informational), regardless of the letter case.
+func ParsePriority(s string) (Priority, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for p, n := range priorityNames {
+		if strings.ToLower(n) == name {
+			return p, nil
+		}
+	}
+	if p, ok := priorityAliases[name]; ok {
+		return p, nil
+	}
+	return PriorityUnknown, fmt.Errorf("unknown priority: %s", s)
+}
+
+// String returns the canonical name of the priority, as printed by Falco
+// in its alerts (e.g. "Warning").
+func (p Priority) String() string {
+	if n, ok := priorityNames[p]; ok {
+		return n
+	}
+	return "Unknown"
+}
+
+// MarshalJSON encodes the priority with its canonical name.
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes the priority from its name or one of its aliases.
+// Empty and unrecognized names decode to PriorityUnknown, so that alerts
+// with a priority not known by this package are not discarded.
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	p.parse(s)
+	return nil
+}
+
+// MarshalYAML encodes the priority with its lowercase name, as used
+// in the Falco config files.
+func (p Priority) MarshalYAML() (interface{}, error) {
+	return strings.ToLower(p.String()), nil
+}
+
+// UnmarshalYAML decodes the priority from its name or one of its aliases.
+// Empty and unrecognized names decode to PriorityUnknown.
+func (p *Priority) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	p.parse(s)
+	return nil
+}
+
+func (p *Priority) parse(s string) {
+	// note: ParsePriority returns PriorityUnknown in case of errors
+	*p, _ = ParsePriority(s)
+}
+
+// toPriority converts a priority given either as a Priority or as a string,
+// and returns an error otherwise or if the string can't be parsed.
+func toPriority(v interface{}) (Priority, error) {
+	if p, ok := v.(Priority); ok {
+		return p, nil
+	}
+	if str, ok := v.(string); ok {
+		return ParsePriority(str)
+	}
+	return PriorityUnknown, fmt.Errorf("priority must be Priority or string, got %T", v)
+}
@@ -21,17 +21,32 @@ package falco
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/falcosecurity/testing/pkg/run"
 	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
 )
 
 var (
 	FalcoConfig                 = DefaultConfigFile
 	FalcoContainerPluginLibrary = DefaultPluginPath + "/libcontainer.so"
+	// FalcoCrashArtifactsDir is the default directory in which crash
+	// artifacts are collected. Collection is disabled if empty.
+	FalcoCrashArtifactsDir = ""
 )
 
+// mainConfigWithIncludesName is the name of the main config file
+// staged when running Falco with config files includes
+const mainConfigWithIncludesName = "falco-main.yaml"
+
 const (
 	// DefaultMaxDuration is the default max duration of a Falco run
 	DefaultMaxDuration = time.Minute * 5
@@ -44,23 +59,78 @@ const (
 	//
 	// DefaultPluginPath is the default path to the Falco plugins
 	DefaultPluginPath = "/usr/share/falco/plugins"
+	//
+	// DefaultCrashStderrTailLines is the default amount of stderr lines
+	// collected as a crash artifact when Falco crashes
+	DefaultCrashStderrTailLines = 100
+	//
+	// DefaultHangOutputTailLines is the default amount of output lines
+	// attached to the hang diagnostics when Falco exceeds its deadline
+	DefaultHangOutputTailLines = 50
+	//
+	// DefaultStopGracePeriod is the default time given to Falco to shut
+	// down gracefully when stopped by a stop condition, before killing it
+	DefaultStopGracePeriod = 10 * time.Second
 )
 
+// ConfigOverride is a config key overridden through the `-o` option
+type ConfigOverride struct {
+	Key   string
+	Value string
+}
+
+func (c ConfigOverride) String() string {
+	return c.Key + "=" + c.Value
+}
+
 type testOptions struct {
-	err      error
-	args     []string
-	files    []run.FileAccessor
-	runOpts  []run.RunnerOption
-	duration time.Duration
-	ctx      context.Context
+	err               error
+	args              []string
+	files             []run.FileAccessor
+	runOpts           []run.RunnerOption
+	duration          time.Duration
+	ctx               context.Context
+	crashArtifactsDir string
+	configName        string
+	config            run.FileAccessor
+	configIncludes    []string
+	configOverrides   []ConfigOverride
+	engine            *Engine
+	alertCallbacks    []AlertCallback
+	alertChannels     []chan<- *Alert
+	stopConditions    []StopCondition
+	grpcOutput        bool
+	httpOutput        bool
+	httpOutputOpts    []HTTPReceiverOption
+	syslogOutput      *syslogOutputOptions
+	outputSinks       []OutputSink
+	fileOutput        bool
+	programOutput     bool
+	programOutputOpts []ProgramSinkOption
+	metricsInterval   time.Duration
+	metricsOutputFile bool
 }
 
 // TestOutput is the output of a Falco test run
 type TestOutput struct {
-	opts   *testOptions
-	err    error
-	stdout bytes.Buffer
-	stderr bytes.Buffer
+	opts           *testOptions
+	err            error
+	stdout         bytes.Buffer
+	stderr         bytes.Buffer
+	journal        *run.Journal
+	cmdLine        []string
+	stagedConfig   map[string]interface{}
+	outputJSON     bool
+	crashArtifacts []string
+	hang           *run.HangDiagnostics
+	wrapperReport  *run.WrapperReport
+	stopped        bool
+	grpc           *GRPCOutput
+	httpReceiver   *HTTPReceiver
+	syslogReceiver *SyslogReceiver
+	sinks          []OutputSink
+	metrics        *MetricsOutput
+	metricsFile    string
 }
 
 // TestOption is an option for testing Falco
@@ -70,46 +140,322 @@ type TestOption func(*testOptions)
 // an output representing the outcome of the run.
 func Test(runner run.Runner, options ...TestOption) *TestOutput {
 	res := &TestOutput{
+		journal: run.NewJournal(),
 		opts: &testOptions{
-			duration: DefaultMaxDuration,
-			ctx:      context.Background(),
+			duration:          DefaultMaxDuration,
+			ctx:               context.Background(),
+			crashArtifactsDir: FalcoCrashArtifactsDir,
+			// enforce Falco config path as default
+			configName: FalcoConfig,
 		},
 	}
 
-	// enforce Falco config path as default
-	res.opts.args = append(res.opts.args, "-c", FalcoConfig)
-
 	// avoids that the container plugin appends its suggested fields
 	// to the rules formatting; in some cases, that can make some tests fail
 	// because expected output format would not match with provided string.
 	// For example: TestFalco_Legacy_ValidateSkipUnknownNoevt and TestFalco_Legacy_InvalidRuleOutput.
-	res.opts.args = append(res.opts.args, "-o", "append_output.suggested_output=false")
+	res.opts.setConfig("append_output.suggested_output", "false")
 
 	for _, o := range options {
 		o(res.opts)
 	}
+	// all sinks are closed once Falco terminates, so that they collect
+	// everything sent to them before being inspected
+	res.sinks = append(res.sinks, res.opts.outputSinks...)
+	defer func() {
+		for _, sink := range res.sinks {
+			if err := sink.Close(); err != nil {
+				logrus.WithField("sink", sink.Name()).WithError(err).Warn("can't close output sink")
+			}
+		}
+	}()
+	res.opts.err = multierr.Append(res.opts.err, res.opts.validateEngine())
 	if res.opts.err != nil {
 		return res
 	}
 
+	// stage a main config file including all the config files includes
+	if len(res.opts.configIncludes) > 0 {
+		config, err := res.opts.mainConfigWithIncludes()
+		if err != nil {
+			res.opts.err = err
+			return res
+		}
+		res.opts.configName = config.Name()
+		res.opts.config = config
+		res.opts.files = append(res.opts.files, config)
+	}
+
+	var grpcCollector *grpcCollector
+	if res.opts.grpcOutput {
+		grpcCollector = newGRPCCollector(runner.WorkDir(), res.opts)
+	}
+
+	// free ports of the host are meaningful only if Falco shares its network
+	if run.SharesHostNetwork(runner) {
+		if err := res.allocatePorts(runner.WorkDir()); err != nil {
+			res.opts.err = err
+			return res
+		}
+	} else {
+		logrus.Debug("runner doesn't share the host network, skipping webserver and gRPC ports allocation")
+	}
+
+	// the metrics file is written in the environment of the runner,
+	// and collected from it once Falco terminates
+	if res.opts.metricsOutputFile {
+		if !run.CollectsFiles(runner) {
+			res.opts.err = fmt.Errorf("internal metrics file requires a runner collecting files")
+			return res
+		}
+		path := filepath.Join(runner.WorkDir(), "metrics.json")
+		res.opts.setConfig("metrics.output_file", path)
+		res.opts.runOpts = append(res.opts.runOpts, run.WithCollectedFile(path, func(content []byte, err error) {
+			// the file is missing if Falco didn't write any snapshot
+			if err != nil && !os.IsNotExist(err) {
+				logrus.WithError(err).Warn("can't collect falco metrics output file")
+			}
+			res.metricsFile = string(content)
+		}))
+	}
+
+	var metricsScraper *metricsScraper
+	if res.opts.metricsInterval > 0 {
+		if !run.SharesHostNetwork(runner) {
+			res.opts.err = fmt.Errorf("metrics scraping requires a runner sharing the host network")
+			return res
+		}
+		metricsScraper = newMetricsScraper(res.MetricsURL(), res.opts.metricsInterval)
+	}
+
+	if res.opts.httpOutput {
+		receiver, err := NewHTTPReceiver(res.opts.httpOutputOpts...)
+		if err != nil {
+			res.opts.err = err
+			return res
+		}
+		res.httpReceiver = receiver
+		res.sinks = append(res.sinks, receiver)
+	}
+
+	if res.opts.syslogOutput != nil {
+		receiver, err := NewSyslogReceiver(res.opts.syslogOutput.network, res.opts.syslogOutput.address)
+		if err != nil {
+			res.opts.err = err
+			return res
+		}
+		res.syslogReceiver = receiver
+		res.sinks = append(res.sinks, receiver)
+	}
+
+	if res.opts.fileOutput {
+		sink, err := NewFileOutputSink()
+		if err != nil {
+			res.opts.err = err
+			return res
+		}
+		res.sinks = append(res.sinks, sink)
+	}
+
+	if res.opts.programOutput {
+		sink, err := NewProgramOutputSink(res.opts.programOutputOpts...)
+		if err != nil {
+			res.opts.err = err
+			return res
+		}
+		res.sinks = append(res.sinks, sink)
+	}
+
+	// the files of the sinks are written in the environment of the runner,
+	// and collected from it once Falco terminates
+	for i, sink := range res.sinks {
+		if s, ok := sink.(runnerSink); ok {
+			if !run.CollectsFiles(runner) {
+				res.opts.err = fmt.Errorf("output sink %s requires a runner collecting files", s.Name())
+				return res
+			}
+			path := filepath.Join(runner.WorkDir(), fmt.Sprintf("%s-%d.txt", s.Name(), i))
+			res.opts.runOpts = append(res.opts.runOpts, s.collect(path))
+		}
+	}
+
+	for _, sink := range res.sinks {
+		for _, c := range sink.Config() {
+			res.opts.setConfig(c.Key, c.Value)
+		}
+	}
+
 	// enforce logging everything on stdout
-	res.opts.args = append(res.opts.args, "-o", "log_level=debug")
-	res.opts.args = append(res.opts.args, "-o", "log_stderr=true")
-	res.opts.args = append(res.opts.args, "-o", "log_syslog=false")
-	res.opts.args = append(res.opts.args, "-o", "stdout_output.enabled=true")
+	res.opts.setConfig("log_level", "debug")
+	res.opts.setConfig("log_stderr", "true")
+	res.opts.setConfig("log_syslog", "false")
+	// alerts are printed on stdout unless the test explicitly opts out
+	if !res.opts.hasConfigOverride("stdout_output.enabled") {
+		res.opts.setConfig("stdout_output.enabled", "true")
+	}
+	res.cmdLine = res.opts.commandLine()
+	res.outputJSON = res.configEnabled("json_output")
+
+	// each run collects its crash artifacts in its own subdirectory,
+	// which is created only in case of a crash
+	var crashDir string
+	if len(res.opts.crashArtifactsDir) > 0 {
+		crashDir = filepath.Join(res.opts.crashArtifactsDir, fmt.Sprintf("falco-%d", time.Now().UnixNano()))
+		res.opts.runOpts = append(res.opts.runOpts, run.WithCoreDumpDir(crashDir))
+	}
 	logrus.WithField("deadline", res.opts.duration).Info("running falco with runner")
 	ctx, cancel := context.WithTimeout(res.opts.ctx, skewedDuration(res.opts.duration))
 	defer cancel()
+	stdout := io.MultiWriter(&res.stdout, res.journal.Writer(run.StreamStdout))
+	var alerts *alertStream
+	if res.opts.hasAlertStream() {
+		stop := make(chan struct{})
+		alerts = &alertStream{
+			callbacks:  res.opts.alertCallbacks,
+			conditions: res.opts.stopConditions,
+			stop:       func() { close(stop) },
+		}
+		stdout = io.MultiWriter(stdout, alerts)
+		res.opts.runOpts = append(res.opts.runOpts, run.WithGracefulStop(stop, DefaultStopGracePeriod))
+	}
+	if grpcCollector != nil {
+		grpcCollector.Start(ctx)
+	}
+	if metricsScraper != nil {
+		metricsScraper.Start(ctx)
+	}
 	res.err = runner.Run(ctx,
 		append([]run.RunnerOption{
-			run.WithArgs(res.opts.args...),
+			run.WithArgs(res.cmdLine...),
 			run.WithFiles(res.opts.files...),
-			run.WithStdout(&res.stdout),
-			run.WithStderr(&res.stderr),
+			run.WithStdout(stdout),
+			run.WithStderr(io.MultiWriter(&res.stderr, res.journal.Writer(run.StreamStderr))),
+			run.WithHangDiagnostics(func(h *run.HangDiagnostics) { res.hang = h }),
+			run.WithWrapperReport(func(r *run.WrapperReport) { res.wrapperReport = r }),
 		}, res.opts.runOpts...)...,
 	)
+	res.journal.Flush()
+	if metricsScraper != nil {
+		res.metrics = metricsScraper.Stop()
+	}
+	if grpcCollector != nil {
+		res.grpc = grpcCollector.Stop()
+	}
+	if alerts != nil {
+		alerts.Flush()
+		for _, ch := range res.opts.alertChannels {
+			close(ch)
+		}
+		// stopping Falco because of a stop condition is not an error,
+		// unless it had to be killed after its grace period
+		if res.stopped = alerts.Stopped(); res.stopped {
+			var sigErr *run.SignalError
+			if errors.As(res.err, &sigErr) && sigErr.Signal == syscall.SIGTERM {
+				res.err = nil
+			}
+		}
+	}
+	if res.hang != nil {
+		entries := res.journal.Entries()
+		if len(entries) > DefaultHangOutputTailLines {
+			entries = entries[len(entries)-DefaultHangOutputTailLines:]
+		}
+		for _, e := range entries {
+			res.hang.OutputTail = append(res.hang.OutputTail, fmt.Sprintf("[%s] %s", e.Stream, e.Line))
+		}
+		logrus.WithField("diagnostics", res.hang.String()).Warn("falco run exceeded its deadline")
+	}
 	if res.err != nil {
 		logrus.WithError(res.err).Warn("error running falco with runner")
 	}
+	if result := res.Result(); result.Crashed() {
+		logrus.WithField("result", result.String()).Error("falco crashed")
+		if len(crashDir) > 0 {
+			res.crashArtifacts = append(res.crashArtifacts, result.CoreDumps...)
+			if err := res.writeStderrTail(crashDir, DefaultCrashStderrTailLines); err != nil {
+				logrus.WithError(err).Warn("can't collect falco stderr as crash artifact")
+			}
+		}
+	}
 	return res
 }
+
+func (t *TestOutput) writeStderrTail(dir string, lines int) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	stderr, err := readLineByLine(strings.NewReader(t.Stderr()))
+	if err != nil {
+		return err
+	}
+	if len(stderr) > lines {
+		stderr = stderr[len(stderr)-lines:]
+	}
+	path := filepath.Join(dir, "stderr.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(stderr, "\n")+"\n"), os.ModePerm); err != nil {
+		return err
+	}
+	t.crashArtifacts = append(t.crashArtifacts, path)
+	return nil
+}
+
+// setConfig overrides the given config key through the `-o` option.
+func (o *testOptions) setConfig(key, value string) {
+	o.configOverrides = append(o.configOverrides, ConfigOverride{Key: key, Value: value})
+}
+
+// addArgs adds the given CLI arguments, by recognizing the ones that are
+// modeled semantically such as `-c` and `-o`.
+func (o *testOptions) addArgs(args ...string) {
+	for i := 0; i < len(args); i++ {
+		hasValue := i+1 < len(args)
+		switch {
+		case (args[i] == "-o" || args[i] == "--option") && hasValue:
+			i++
+			key, value, _ := strings.Cut(args[i], "=")
+			o.setConfig(key, value)
+		case strings.HasPrefix(args[i], "--option="):
+			key, value, _ := strings.Cut(strings.TrimPrefix(args[i], "--option="), "=")
+			o.setConfig(key, value)
+		case args[i] == "-c" && hasValue:
+			i++
+			o.configName = args[i]
+			o.config = nil
+		default:
+			o.args = append(o.args, args[i])
+		}
+	}
+}
+
+// commandLine returns the CLI arguments with which Falco is run. All the
+// `-o` options are placed after the other arguments, in the order in which
+// they were set.
+func (o *testOptions) commandLine() []string {
+	res := []string{"-c", o.configName}
+	res = append(res, o.args...)
+	for _, c := range o.configOverrides {
+		res = append(res, "-o", c.String())
+	}
+	return res
+}
+
+// mainConfig returns the main Falco config file, which is either the one
+// set with WithConfig or the default one.
+func (o *testOptions) mainConfig() run.FileAccessor {
+	if o.config != nil {
+		return o.config
+	}
+	return run.NewLocalFileAccessor(o.configName, o.configName)
+}
+
+// mainConfigWithIncludes returns a copy of the main Falco config file
+// of which config_files key is extended with all the staged includes.
+func (o *testOptions) mainConfigWithIncludes() (run.FileAccessor, error) {
+	builder := NewConfigBuilder().WithFile(o.mainConfig())
+	config, err := builder.Config()
+	if err != nil {
+		return nil, err
+	}
+	includes := append(config.ConfigFiles, o.configIncludes...)
+	return builder.Set("config_files", includes).Build(mainConfigWithIncludesName)
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/falcosecurity/client-go/pkg/api/outputs"
+	"github.com/falcosecurity/client-go/pkg/api/version"
+	"github.com/falcosecurity/client-go/pkg/client"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcPollInterval is the interval with which the gRPC collector
+	// checks whether Falco created its unix socket
+	grpcPollInterval = 100 * time.Millisecond
+	//
+	// grpcWatchTimeout is the interval with which the gRPC collector
+	// requests new outputs to Falco
+	grpcWatchTimeout = 100 * time.Millisecond
+)
+
+// GRPCOutput is the outcome of collecting the outputs of a Falco run
+// through its gRPC server.
+type GRPCOutput struct {
+	// Detections are the alerts received through the outputs service
+	Detections Detections
+	//
+	// Version is the response of the version service, or nil if
+	// the collector failed connecting to Falco
+	Version *version.Response
+	//
+	// Err is a non-nil error in case of issues when collecting outputs
+	Err error
+}
+
+// WithGRPCOutput runs Falco by enabling its gRPC server and gRPC output on
+// a unix socket dedicated to the run. Once Falco is ready, a client connects
+// to the socket, queries the version service, and collects the alerts
+// streamed by the outputs service until Falco terminates (see
+// TestOutput.GRPCOutput). The socket is created in the working directory
+// of the runner, so this requires the runner to share the filesystem with
+// the Falco process. Note that Falco may terminate before the collector
+// connects if it's run on a short capture file.
+func WithGRPCOutput() TestOption {
+	return func(o *testOptions) {
+		o.grpcOutput = true
+	}
+}
+
+// GRPCOutput returns the outputs collected through the Falco gRPC server.
+// Returns nil if Falco wasn't run with WithGRPCOutput.
+func (t *TestOutput) GRPCOutput() *GRPCOutput {
+	return t.grpc
+}
+
+// grpcCollector collects Falco outputs from its gRPC server
+type grpcCollector struct {
+	m          sync.Mutex
+	socketPath string
+	res        GRPCOutput
+	wg         sync.WaitGroup
+	cancel     context.CancelFunc
+}
+
+// newGRPCCollector creates a collector for a gRPC server listening on
+// a new unix socket in the given directory, and sets up the given
+// options for Falco to listen on it.
+func newGRPCCollector(dir string, o *testOptions) *grpcCollector {
+	c := &grpcCollector{
+		socketPath: filepath.Join(dir, fmt.Sprintf("falco-grpc-%d.sock", time.Now().UnixNano())),
+	}
+	o.setConfig("grpc.enabled", "true")
+	o.setConfig("grpc.bind_address", "unix://"+c.socketPath)
+	o.setConfig("grpc.threadiness", "1")
+	o.setConfig("grpc_output.enabled", "true")
+	return c
+}
+
+// Start starts collecting outputs in the background, until Stop is invoked.
+func (c *grpcCollector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := c.collect(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logrus.WithError(err).Warn("error collecting falco grpc outputs")
+			c.m.Lock()
+			c.res.Err = err
+			c.m.Unlock()
+		}
+	}()
+}
+
+// Stop stops collecting outputs and returns what has been collected.
+func (c *grpcCollector) Stop() *GRPCOutput {
+	c.cancel()
+	c.wg.Wait()
+	c.m.Lock()
+	defer c.m.Unlock()
+	res := c.res
+	return &res
+}
+
+func (c *grpcCollector) collect(ctx context.Context) error {
+	// wait for Falco to be ready by waiting for its socket to be created
+	for {
+		if _, err := os.Stat(c.socketPath); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("falco grpc socket not created: %w", ctx.Err())
+		case <-time.After(grpcPollInterval):
+		}
+	}
+
+	cl, err := client.NewForConfig(ctx, &client.Config{UnixSocketPath: "unix://" + c.socketPath})
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	vc, err := cl.Version()
+	if err != nil {
+		return err
+	}
+	v, err := vc.Version(ctx, &version.Request{}, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	c.m.Lock()
+	c.res.Version = v
+	c.m.Unlock()
+
+	err = cl.OutputsWatch(ctx, func(res *outputs.Response) error {
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.res.Detections = append(c.res.Detections, GRPCResponseToAlert(res))
+		return nil
+	}, grpcWatchTimeout)
+	// the server becoming unavailable means that Falco terminated
+	if status.Code(err) == codes.Unavailable {
+		return nil
+	}
+	return err
+}
+
+// GRPCResponseToAlert converts a response of the Falco gRPC outputs service
+// into an Alert. Output field values are all reported as strings.
+func GRPCResponseToAlert(res *outputs.Response) *Alert {
+	outputFields := make(map[string]interface{})
+	for k, v := range res.OutputFields {
+		outputFields[k] = v
+	}
+	priority, err := ParsePriority(res.Priority.String())
+	if err != nil {
+		logrus.WithError(err).Debugf("GRPCResponseToAlert: can't parse priority")
+	}
+	return &Alert{
+		Time:         res.Time.AsTime(),
+		Rule:         res.Rule,
+		Output:       res.Output,
+		Priority:     priority,
+		Source:       res.Source,
+		Hostname:     res.Hostname,
+		Tags:         res.Tags,
+		OutputFields: outputFields,
+	}
+}
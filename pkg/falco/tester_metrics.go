@@ -0,0 +1,414 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMetricsScrapeInterval is the interval with which metrics are
+	// scraped if no other is specified
+	DefaultMetricsScrapeInterval = time.Second
+)
+
+// metricsScrapeRetryInterval is the interval with which failed scrapes are
+// retried until the first one succeeds, since the webserver takes some time
+// to come up after Falco starts
+const metricsScrapeRetryInterval = 100 * time.Millisecond
+
+// Names of some of the metrics exposed by the Falco prometheus endpoint.
+const (
+	MetricEventsProcessed = "falcosecurity_scap_n_evts_total"
+	MetricEventsDropped   = "falcosecurity_scap_n_drops_total"
+	MetricRuleMatches     = "falcosecurity_falco_rules_matches_total"
+	MetricOutputsDropped  = "falcosecurity_falco_outputs_queue_num_drops_total"
+)
+
+// MetricSample is a single sample of a metric in the Prometheus text
+// exposition format.
+type MetricSample struct {
+	Name string
+	//
+	// Type is the type declared for the metric family of the sample,
+	// such as "counter" or "gauge", or "untyped" if none is declared
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricSamples represents a list of metric samples.
+type MetricSamples []*MetricSample
+
+// MetricsSnapshot is the set of samples exposed by Falco at a given time.
+type MetricsSnapshot struct {
+	Time    time.Time
+	Samples MetricSamples
+}
+
+// MetricsOutput is the outcome of scraping the Falco prometheus endpoint
+// during a run.
+type MetricsOutput struct {
+	// URL is the URL from which the metrics were scraped
+	URL string
+	//
+	// Snapshots are all the successful scrapes, in order of time
+	Snapshots []*MetricsSnapshot
+	//
+	// Err is a non-nil error in case no scrape succeeded
+	Err error
+}
+
+// Final returns the last snapshot scraped before Falco terminated,
+// or nil if no scrape succeeded.
+func (m *MetricsOutput) Final() *MetricsSnapshot {
+	if len(m.Snapshots) == 0 {
+		return nil
+	}
+	return m.Snapshots[len(m.Snapshots)-1]
+}
+
+// WithMetricsScraping runs Falco with its prometheus metrics endpoint
+// enabled (see WithPrometheusMetrics), and scrapes it with the given
+// interval until Falco terminates (see TestOutput.Metrics). A non-positive
+// interval means DefaultMetricsScrapeInterval. The first scrape happens as
+// soon as Falco starts, and is retried until its webserver is up. The
+// endpoint is reached from the host, so this requires the runner to share
+// the network with the Falco process (see run.SharesHostNetwork), or the
+// run fails. Since Falco can't be scraped after it terminates, the final
+// snapshot is the last one scraped while running, which makes short
+// intervals more accurate.
+func WithMetricsScraping(interval time.Duration) TestOption {
+	return func(o *testOptions) {
+		WithPrometheusMetrics()(o)
+		o.metricsInterval = interval
+		if interval <= 0 {
+			o.metricsInterval = DefaultMetricsScrapeInterval
+		}
+	}
+}
+
+// Metrics returns the metrics scraped during the run. Returns nil if Falco
+// wasn't run with WithMetricsScraping.
+func (t *TestOutput) Metrics() *MetricsOutput {
+	return t.metrics
+}
+
+// metricsScraper periodically scrapes the Falco prometheus endpoint
+type metricsScraper struct {
+	m        sync.Mutex
+	interval time.Duration
+	res      MetricsOutput
+	wg       sync.WaitGroup
+	cancel   context.CancelFunc
+}
+
+func newMetricsScraper(url string, interval time.Duration) *metricsScraper {
+	return &metricsScraper{interval: interval, res: MetricsOutput{URL: url}}
+}
+
+// Start starts scraping metrics in the background, until Stop is invoked.
+func (s *metricsScraper) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		var err error
+		var delay time.Duration
+		for {
+			select {
+			case <-ctx.Done():
+				s.m.Lock()
+				if len(s.res.Snapshots) == 0 {
+					s.res.Err = fmt.Errorf("no metrics scraped from %s", s.res.URL)
+					if err != nil {
+						s.res.Err = fmt.Errorf("%s: %w", s.res.Err.Error(), err)
+					}
+					logrus.WithError(s.res.Err).Warn("error scraping falco metrics")
+				}
+				s.m.Unlock()
+				return
+			case <-time.After(delay):
+			}
+			var snapshot *MetricsSnapshot
+			snapshot, err = s.scrape(ctx)
+			if err != nil {
+				// failures are expected until the webserver is up
+				delay = min(s.interval, metricsScrapeRetryInterval)
+				continue
+			}
+			s.m.Lock()
+			s.res.Snapshots = append(s.res.Snapshots, snapshot)
+			s.m.Unlock()
+			delay = s.interval
+		}
+	}()
+}
+
+// Stop stops scraping metrics and returns what has been scraped.
+func (s *metricsScraper) Stop() *MetricsOutput {
+	s.cancel()
+	s.wg.Wait()
+	s.m.Lock()
+	defer s.m.Unlock()
+	res := s.res
+	return &res
+}
+
+func (s *metricsScraper) scrape(ctx context.Context) (*MetricsSnapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.res.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from metrics endpoint: %d", res.StatusCode)
+	}
+	samples, err := ParsePrometheusMetrics(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsSnapshot{Time: time.Now(), Samples: samples}, nil
+}
+
+// ParsePrometheusMetrics parses metric samples in the Prometheus text
+// exposition format. Comments other than type declarations are ignored.
+func ParsePrometheusMetrics(r io.Reader) (MetricSamples, error) {
+	var res MetricSamples
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		sample, err := parseMetricSample(line)
+		if err != nil {
+			return nil, err
+		}
+		sample.Type = metricType(types, sample.Name)
+		res = append(res, sample)
+	}
+	return res, scanner.Err()
+}
+
+func metricType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	// samples of histograms and summaries have suffixed names
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if t, ok := types[strings.TrimSuffix(name, suffix)]; ok && strings.HasSuffix(name, suffix) {
+			return t
+		}
+	}
+	return "untyped"
+}
+
+func parseMetricSample(line string) (*MetricSample, error) {
+	res := &MetricSample{Labels: make(map[string]string)}
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid metric sample: %s", line)
+	}
+	res.Name = line[:i]
+	rest := line[i:]
+	if rest[0] == '{' {
+		var err error
+		rest, err = parseMetricLabels(rest[1:], res.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric sample: %s: %w", line, err)
+		}
+	}
+	// the value is optionally followed by a timestamp, which we ignore
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid metric sample: %s", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric sample: %s: %w", line, err)
+	}
+	res.Value = value
+	return res, nil
+}
+
+// parseMetricLabels parses the labels of a sample up to the closing brace,
+// and returns the remainder of the line
+func parseMetricLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", fmt.Errorf("malformed labels")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+		var sb strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					sb.WriteByte('\n')
+				} else {
+					sb.WriteByte(s[i])
+				}
+				continue
+			}
+			if s[i] == '"' {
+				s, closed = s[i+1:], true
+				break
+			}
+			sb.WriteByte(s[i])
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated label value")
+		}
+		labels[name] = sb.String()
+	}
+}
+
+func (m MetricSamples) filter(f func(*MetricSample) bool) MetricSamples {
+	var res MetricSamples
+	for _, s := range m {
+		if f(s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// OfName returns the list of samples of the metrics with the given name.
+func (m MetricSamples) OfName(name string) MetricSamples {
+	return m.filter(func(s *MetricSample) bool {
+		return s.Name == name
+	})
+}
+
+// OfNameMatching returns the list of samples of the metrics of which name
+// matches the given regular expression.
+func (m MetricSamples) OfNameMatching(rgx *regexp.Regexp) MetricSamples {
+	return m.filter(func(s *MetricSample) bool {
+		return rgx.MatchString(s.Name)
+	})
+}
+
+// WithLabel returns the list of samples having a label with the given name
+// and value.
+func (m MetricSamples) WithLabel(name, value string) MetricSamples {
+	return m.filter(func(s *MetricSample) bool {
+		l, ok := s.Labels[name]
+		return ok && l == value
+	})
+}
+
+// WithLabelMatching returns the list of samples having a label with the
+// given name, of which value matches the given regular expression.
+func (m MetricSamples) WithLabelMatching(name string, rgx *regexp.Regexp) MetricSamples {
+	return m.filter(func(s *MetricSample) bool {
+		l, ok := s.Labels[name]
+		return ok && rgx.MatchString(l)
+	})
+}
+
+// Names returns the sorted names of all the metrics in the list.
+func (m MetricSamples) Names() []string {
+	names := make(map[string]bool)
+	for _, s := range m {
+		names[s.Name] = true
+	}
+	return sortedKeys(names)
+}
+
+// Has returns true if the list contains at least one sample of the metric
+// with the given name.
+func (m MetricSamples) Has(name string) bool {
+	return m.OfName(name).Count() > 0
+}
+
+// Sum returns the sum of the values of all the samples in the list.
+func (m MetricSamples) Sum() float64 {
+	var res float64
+	for _, s := range m {
+		res += s.Value
+	}
+	return res
+}
+
+// Count returns the amount of samples in the list.
+func (m MetricSamples) Count() int {
+	return len(m)
+}
+
+// EventsProcessed returns the amount of events processed by Falco.
+func (m MetricSamples) EventsProcessed() float64 {
+	return m.OfName(MetricEventsProcessed).Sum()
+}
+
+// EventsDropped returns the amount of events dropped by Falco.
+func (m MetricSamples) EventsDropped() float64 {
+	return m.OfName(MetricEventsDropped).Sum()
+}
+
+// RuleMatches returns the amount of matches of the given rule, or of all
+// rules if the name is empty.
+func (m MetricSamples) RuleMatches(rule string) float64 {
+	samples := m.OfName(MetricRuleMatches)
+	if len(rule) > 0 {
+		samples = samples.WithLabel("rule_name", rule)
+	}
+	return samples.Sum()
+}
+
+// Series returns the values of the metric with the given name across all
+// the snapshots, summed over its labels, in order of time.
+func (m *MetricsOutput) Series(name string) []float64 {
+	res := make([]float64, 0, len(m.Snapshots))
+	for _, s := range m.Snapshots {
+		res = append(res, s.Samples.OfName(name).Sum())
+	}
+	return res
+}
@@ -21,9 +21,13 @@ package falco
 import (
 	"context"
 	"fmt"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/falcosecurity/testing/pkg/run"
+	"go.uber.org/multierr"
 )
 
 func withMultipleArgValues(arg string, values ...string) TestOption {
@@ -37,7 +41,13 @@ func withMultipleArgValues(arg string, values ...string) TestOption {
 
 // WithArgs runs Falco with the given arguments.
 func WithArgs(args ...string) TestOption {
-	return func(ro *testOptions) { ro.args = append(ro.args, args...) }
+	return func(ro *testOptions) { ro.addArgs(args...) }
+}
+
+// WithConfigOverride runs Falco by overriding the given config key
+// through the `-o` option.
+func WithConfigOverride(key, value string) TestOption {
+	return func(o *testOptions) { o.setConfig(key, value) }
 }
 
 // WithRules runs Falco with the given rules files through the `-r` option.
@@ -53,18 +63,57 @@ func WithRules(rules ...run.FileAccessor) TestOption {
 // WithConfig runs Falco with the given config file through the `-c` option.
 func WithConfig(f run.FileAccessor) TestOption {
 	return func(o *testOptions) {
-		o.args = removeFromArgs(o.args, "-c", 1)
-		o.args = append(o.args, "-c", f.Name())
+		o.configName = f.Name()
 		o.files = append(o.files, f)
+		o.config = f
+	}
+}
+
+// WithConfigIncludes runs Falco with the given config files included by the
+// main config file through the `config_files` config key, after the ones
+// it already includes. Files are merged in order on top of the main config
+// file, which is either the default one or the one set with WithConfig.
+func WithConfigIncludes(includes ...run.FileAccessor) TestOption {
+	return func(o *testOptions) {
+		for _, f := range includes {
+			o.configIncludes = append(o.configIncludes, f.Name())
+			o.files = append(o.files, f)
+		}
+	}
+}
+
+// WithConfigIncludeDir runs Falco with the given config files staged in a
+// directory with the given relative path, which is included by the main
+// config file through the `config_files` config key. Falco merges the files
+// of a directory in the alphabetical order of their names.
+func WithConfigIncludeDir(dir string, files ...run.FileAccessor) TestOption {
+	return func(o *testOptions) {
+		if path.IsAbs(dir) {
+			o.err = multierr.Append(o.err, fmt.Errorf("config include dir must be a relative path: %s", dir))
+			return
+		}
+		o.configIncludes = append(o.configIncludes, dir)
+		for _, f := range files {
+			o.files = append(o.files, &configIncludeDirFile{dir: dir, FileAccessor: f})
+		}
 	}
 }
 
+type configIncludeDirFile struct {
+	run.FileAccessor
+	dir string
+}
+
+func (c *configIncludeDirFile) Name() string {
+	return path.Join(c.dir, path.Base(c.FileAccessor.Name()))
+}
+
 // WithEnabledTags runs Falco with enabled rules tags through the `-t` option.
 func WithEnabledTags(tags ...string) TestOption {
 	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "rules[].disable.rule=*")
+		o.setConfig("rules[].disable.rule", "*")
 		for _, t := range tags {
-			o.args = append(o.args, "-o", "rules[].enable.tag="+t)
+			o.setConfig("rules[].enable.tag", t)
 		}
 	}
 }
@@ -73,7 +122,7 @@ func WithEnabledTags(tags ...string) TestOption {
 func WithDisabledTags(tags ...string) TestOption {
 	return func(o *testOptions) {
 		for _, t := range tags {
-			o.args = append(o.args, "-o", "rules[].disable.tag="+t)
+			o.setConfig("rules[].disable.tag", t)
 		}
 	}
 }
@@ -82,7 +131,7 @@ func WithDisabledTags(tags ...string) TestOption {
 func WithDisabledRules(rules ...string) TestOption {
 	return func(o *testOptions) {
 		for _, r := range rules {
-			o.args = append(o.args, "-o", "rules[].disable.rule="+r)
+			o.setConfig("rules[].disable.rule", r)
 		}
 	}
 }
@@ -100,41 +149,60 @@ func WithDisabledSources(sources ...string) TestOption {
 // WithPrometheusMetrics runs Falco enabling prometheus metrics endpoint.
 func WithPrometheusMetrics() TestOption {
 	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "metrics.enabled=true")
-		o.args = append(o.args, "-o", "metrics.output_rule=true")
-		o.args = append(o.args, "-o", "metrics.interval=2s")
-		o.args = append(o.args, "-o", "webserver.enabled=true")
-		o.args = append(o.args, "-o", "webserver.prometheus_metrics_enabled=true")
+		o.setConfig("metrics.enabled", "true")
+		o.setConfig("metrics.output_rule", "true")
+		o.setConfig("metrics.interval", "2s")
+		o.setConfig("webserver.enabled", "true")
+		o.setConfig("webserver.prometheus_metrics_enabled", "true")
 	}
 }
 
 // WithMinRulePriority runs Falco by forcing a mimimum rules priority.
 func WithMinRulePriority(priority string) TestOption {
 	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "priority="+priority)
+		o.setConfig("priority", priority)
 	}
 }
 
+// WithMinPriority runs Falco by forcing a minimum rules priority,
+// like WithMinRulePriority but with a typed Priority.
+func WithMinPriority(priority Priority) TestOption {
+	return WithMinRulePriority(strings.ToLower(priority.String()))
+}
+
 // WithOutputJSON runs Falco by forcing a the output in JSON format.
 func WithOutputJSON() TestOption {
 	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "json_output=true")
+		o.setConfig("json_output", "true")
+	}
+}
+
+// WithOutputTimeout runs Falco by setting the time after which the
+// outputs are considered blocked through the `output_timeout` config.
+func WithOutputTimeout(timeout time.Duration) TestOption {
+	return func(o *testOptions) {
+		o.setConfig("output_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
+}
+
+// WithOutputsQueueCapacity runs Falco by bounding the amount of alerts
+// waiting to be sent to the output channels, after which they're dropped.
+func WithOutputsQueueCapacity(capacity int) TestOption {
+	return func(o *testOptions) {
+		o.setConfig("outputs_queue.capacity", strconv.Itoa(capacity))
 	}
 }
 
 // WithAllEvents runs Falco with all events enabled through the `-A` option.
 func WithAllEvents() TestOption {
 	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "base_syscalls.all=true")
+		o.setConfig("base_syscalls.all", "true")
 	}
 }
 
 // WithCaptureFile runs Falco reading events from a capture file through the `-o engine.kind=replay` option.
 func WithCaptureFile(f run.FileAccessor) TestOption {
-	return func(o *testOptions) {
-		o.args = append(o.args, "-o", "engine.kind=replay", "-o", fmt.Sprintf("engine.replay.capture_file=%s", f.Name()))
-		o.files = append(o.files, f)
-	}
+	return WithEngine(&Engine{Kind: EngineReplay, CaptureFile: f})
 }
 
 // WithContextDeadline runs Falco with a maximum context deadline.
@@ -182,3 +250,11 @@ func WithStopAfter(duration time.Duration) TestOption {
 		o.args = append(o.args, "-M", fmt.Sprintf("%d", int64(duration.Seconds())))
 	}
 }
+
+// WithCrashArtifacts runs Falco by collecting its core dumps and the tail of
+// its stderr into a subdirectory of the given directory in case it crashes.
+// Core dumps are only collected if the kernel's core pattern is not piped
+// to an external program, and only by runners supporting it.
+func WithCrashArtifacts(dir string) TestOption {
+	return func(o *testOptions) { o.crashArtifactsDir = dir }
+}
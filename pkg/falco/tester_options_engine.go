@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/falcosecurity/testing/pkg/run"
+	"go.uber.org/multierr"
+)
+
+// EngineKind is the kind of engine with which Falco collects syscall events
+type EngineKind string
+
+const (
+	// EngineReplay reads events from a capture file
+	EngineReplay EngineKind = "replay"
+	// EngineNoDriver collects no syscall events, which is useful when
+	// running Falco with plugins only
+	EngineNoDriver EngineKind = "nodriver"
+	// EngineKmod collects events with the kernel module
+	EngineKmod EngineKind = "kmod"
+	// EngineEBPF collects events with the legacy eBPF probe
+	EngineEBPF EngineKind = "ebpf"
+	// EngineModernEBPF collects events with the modern eBPF probe
+	EngineModernEBPF EngineKind = "modern_ebpf"
+	// EngineGVisor collects events from a gVisor sandbox
+	EngineGVisor EngineKind = "gvisor"
+)
+
+const (
+	engineMaxBufSizePreset = 10
+)
+
+// Engine describes the engine with which Falco collects syscall events,
+// along with its parameters. Parameters that are not supported by the
+// given engine kind make the test fail before launching Falco.
+type Engine struct {
+	Kind EngineKind
+	// BufSizePreset is the preset of the per-CPU buffers size, supported
+	// by the kmod, ebpf, and modern_ebpf engines
+	BufSizePreset *int
+	// DropFailedExit drops the exit events of failed syscalls, supported
+	// by the kmod, ebpf, and modern_ebpf engines
+	DropFailedExit *bool
+	// CPUsForEachBuffer is the amount of CPUs sharing the same buffer,
+	// supported by the modern_ebpf engine only
+	CPUsForEachBuffer *int
+	// Probe is the path of the probe, supported by the ebpf engine only
+	Probe string
+	// CaptureFile is the capture file to read events from, required by
+	// the replay engine
+	CaptureFile run.FileAccessor
+	// GVisorConfig is the path of the gVisor config, required by the gvisor engine
+	GVisorConfig string
+	// GVisorRoot is the path of the gVisor root directory, supported by
+	// the gvisor engine only
+	GVisorRoot string
+}
+
+func (e *Engine) isDriver() bool {
+	return e.Kind == EngineKmod || e.Kind == EngineEBPF || e.Kind == EngineModernEBPF
+}
+
+// validate returns a non-nil error if the engine parameters are not
+// compatible with each other or with the engine kind.
+func (e *Engine) validate() error {
+	var err error
+	unsupported := func(param string) {
+		err = multierr.Append(err, fmt.Errorf("engine '%s' does not support parameter '%s'", e.Kind, param))
+	}
+	switch e.Kind {
+	case EngineReplay, EngineNoDriver, EngineKmod, EngineEBPF, EngineModernEBPF, EngineGVisor:
+	default:
+		return fmt.Errorf("unknown engine kind '%s'", e.Kind)
+	}
+	if !e.isDriver() {
+		if e.BufSizePreset != nil {
+			unsupported("buf_size_preset")
+		}
+		if e.DropFailedExit != nil {
+			unsupported("drop_failed_exit")
+		}
+	}
+	if e.BufSizePreset != nil && (*e.BufSizePreset < 0 || *e.BufSizePreset > engineMaxBufSizePreset) {
+		err = multierr.Append(err, fmt.Errorf("engine buf_size_preset must be between 0 and %d: %d", engineMaxBufSizePreset, *e.BufSizePreset))
+	}
+	if e.CPUsForEachBuffer != nil {
+		if e.Kind != EngineModernEBPF {
+			unsupported("cpus_for_each_buffer")
+		} else if *e.CPUsForEachBuffer < 0 {
+			err = multierr.Append(err, fmt.Errorf("engine cpus_for_each_buffer must not be negative: %d", *e.CPUsForEachBuffer))
+		}
+	}
+	if len(e.Probe) > 0 && e.Kind != EngineEBPF {
+		unsupported("probe")
+	}
+	if e.CaptureFile != nil && e.Kind != EngineReplay {
+		unsupported("capture_file")
+	}
+	if e.CaptureFile == nil && e.Kind == EngineReplay {
+		err = multierr.Append(err, fmt.Errorf("engine '%s' requires a capture file", e.Kind))
+	}
+	if len(e.GVisorRoot) > 0 && e.Kind != EngineGVisor {
+		unsupported("root")
+	}
+	if len(e.GVisorConfig) > 0 && e.Kind != EngineGVisor {
+		unsupported("config")
+	}
+	if len(e.GVisorConfig) == 0 && e.Kind == EngineGVisor {
+		err = multierr.Append(err, fmt.Errorf("engine '%s' requires a config", e.Kind))
+	}
+	return err
+}
+
+// configOverrides returns the config keys to be overridden for
+// selecting the engine and its parameters.
+func (e *Engine) configOverrides() []ConfigOverride {
+	prefix := "engine." + string(e.Kind) + "."
+	res := []ConfigOverride{{Key: "engine.kind", Value: string(e.Kind)}}
+	add := func(key, value string) {
+		res = append(res, ConfigOverride{Key: prefix + key, Value: value})
+	}
+	if e.BufSizePreset != nil {
+		add("buf_size_preset", strconv.Itoa(*e.BufSizePreset))
+	}
+	if e.DropFailedExit != nil {
+		add("drop_failed_exit", strconv.FormatBool(*e.DropFailedExit))
+	}
+	if e.CPUsForEachBuffer != nil {
+		add("cpus_for_each_buffer", strconv.Itoa(*e.CPUsForEachBuffer))
+	}
+	if len(e.Probe) > 0 {
+		add("probe", e.Probe)
+	}
+	if e.CaptureFile != nil {
+		add("capture_file", e.CaptureFile.Name())
+	}
+	if len(e.GVisorConfig) > 0 {
+		add("config", e.GVisorConfig)
+	}
+	if len(e.GVisorRoot) > 0 {
+		add("root", e.GVisorRoot)
+	}
+	return res
+}
+
+// WithEngine runs Falco with the given engine through the `engine` config key.
+// The engine can be set only once, and its parameters are validated before
+// launching Falco.
+func WithEngine(e *Engine) TestOption {
+	return func(o *testOptions) {
+		if o.engine != nil {
+			o.err = multierr.Append(o.err, fmt.Errorf("engine already set to '%s', can't set it to '%s'", o.engine.Kind, e.Kind))
+			return
+		}
+		if err := e.validate(); err != nil {
+			o.err = multierr.Append(o.err, err)
+			return
+		}
+		o.engine = e
+		o.configOverrides = append(o.configOverrides, e.configOverrides()...)
+		if e.CaptureFile != nil {
+			o.files = append(o.files, e.CaptureFile)
+		}
+	}
+}
+
+// validateEngine returns a non-nil error if the engine set with WithEngine
+// is overridden by conflicting config overrides.
+func (o *testOptions) validateEngine() error {
+	if o.engine == nil {
+		return nil
+	}
+	for _, c := range o.configOverrides {
+		if c.Key == "engine.kind" && c.Value != string(o.engine.Kind) {
+			return fmt.Errorf("engine set to '%s' conflicts with config override '%s'", o.engine.Kind, c.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// AlertCallback is a function invoked for each alert produced by Falco.
+type AlertCallback func(*Alert)
+
+// StopCondition is a predicate evaluated on the detections observed so far
+// during a Falco run. Falco is stopped as soon as it returns true.
+type StopCondition func(Detections) bool
+
+// WithAlertCallback runs Falco by parsing the alerts from its stdout as they
+// are produced, and by invoking the given callback for each of them.
+// Alerts are parsed either in JSON or in text format (see Detections).
+// The callback is invoked synchronously with the reading of Falco's output.
+func WithAlertCallback(f AlertCallback) TestOption {
+	return func(o *testOptions) {
+		o.alertCallbacks = append(o.alertCallbacks, f)
+	}
+}
+
+// WithAlertChannel runs Falco by sending on the given channel each alert
+// parsed from its stdout as it is produced. The channel is closed once
+// Falco terminates. Sends are blocking, so the channel must be consumed
+// concurrently unless it's buffered enough to contain all the alerts.
+// Alerts are parsed either in JSON or in text format (see Detections).
+func WithAlertChannel(ch chan<- *Alert) TestOption {
+	return func(o *testOptions) {
+		o.alertCallbacks = append(o.alertCallbacks, func(a *Alert) { ch <- a })
+		o.alertChannels = append(o.alertChannels, ch)
+	}
+}
+
+// WithStopCondition runs Falco by stopping it as soon as the given predicate
+// holds for the alerts observed so far. The predicate is evaluated each time
+// a new alert is parsed from Falco's stdout. Falco is stopped gracefully with
+// SIGTERM, and killed only if it doesn't terminate within
+// DefaultStopGracePeriod. Stopping Falco this way is not considered an error
+// (see StopConditionMet), unless it had to be killed.
+// Alerts are parsed either in JSON or in text format (see Detections).
+func WithStopCondition(f StopCondition) TestOption {
+	return func(o *testOptions) {
+		o.stopConditions = append(o.stopConditions, f)
+	}
+}
+
+// WithStopAfterAlerts runs Falco by stopping it as soon as at least 'count'
+// alerts of the given rule are observed. The rule name can either be a
+// string or a *regexp.Regexp.
+func WithStopAfterAlerts(count int, rule interface{}) TestOption {
+	return WithStopCondition(func(d Detections) bool {
+		return d.OfRule(rule).Count() >= count
+	})
+}
+
+// alertStream is a writer parsing Falco alerts from the lines written to it
+type alertStream struct {
+	m          sync.Mutex
+	buf        bytes.Buffer
+	detections Detections
+	callbacks  []AlertCallback
+	conditions []StopCondition
+	stop       func()
+	stopped    bool
+}
+
+func (o *testOptions) hasAlertStream() bool {
+	return len(o.alertCallbacks) > 0 || len(o.stopConditions) > 0
+}
+
+func (s *alertStream) Write(p []byte) (int, error) {
+	// lines are dispatched without holding the lock, so that callbacks
+	// and channel sends don't block concurrent calls to Stopped
+	s.m.Lock()
+	var lines []string
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.buf.Write(p)
+			break
+		}
+		s.buf.Write(p[:i])
+		lines = append(lines, s.buf.String())
+		s.buf.Reset()
+		p = p[i+1:]
+	}
+	s.m.Unlock()
+	for _, line := range lines {
+		s.dispatch(line)
+	}
+	return n, nil
+}
+
+// Flush parses the pending incomplete line, if any.
+func (s *alertStream) Flush() {
+	s.m.Lock()
+	line := s.buf.String()
+	s.buf.Reset()
+	s.m.Unlock()
+	if len(line) > 0 {
+		s.dispatch(line)
+	}
+}
+
+// Stopped returns true if Falco was stopped because a stop condition held.
+func (s *alertStream) Stopped() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.stopped
+}
+
+func (s *alertStream) dispatch(line string) {
+	alert, err := parseAlert(strings.TrimSuffix(line, "\r"))
+	if err != nil {
+		return
+	}
+	s.m.Lock()
+	s.detections = append(s.detections, alert)
+	detections := s.detections[:len(s.detections):len(s.detections)]
+	stopped := s.stopped
+	s.m.Unlock()
+
+	for _, f := range s.callbacks {
+		f(alert)
+	}
+	if stopped {
+		return
+	}
+	for _, f := range s.conditions {
+		if f(detections) {
+			s.m.Lock()
+			if !s.stopped {
+				s.stopped = true
+				s.stop()
+			}
+			s.m.Unlock()
+			return
+		}
+	}
+}
@@ -21,19 +21,64 @@ package falco
 import (
 	"context"
 	"encoding/json"
+	"strings"
 
 	"github.com/falcosecurity/testing/pkg/run"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
 )
 
-func (t *TestOutput) hasOutputJSON() bool {
-	for i := 0; i < len(t.opts.args)-1; i++ {
-		if t.opts.args[i] == "-o" && t.opts.args[i+1] == "json_output=true" {
-			return true
+// CommandLine returns the effective CLI arguments with which Falco was run,
+// excluding the executable itself.
+func (t *TestOutput) CommandLine() []string {
+	return t.cmdLine
+}
+
+// ConfigOverrides returns the list of config keys overridden through
+// the `-o` option, in the order in which they were passed to Falco.
+func (t *TestOutput) ConfigOverrides() []ConfigOverride {
+	return t.opts.configOverrides
+}
+
+// ConfigValue returns the effective value of the given config key, in the
+// dot-separated syntax of the `-o` option (e.g. "webserver.listen_port").
+// The value is resolved on the host by looking at the last override of the
+// key first, and then at the staged config files (see StagedConfig), so it
+// is an approximation of what Falco actually loaded. Returns false if the
+// key is not set in any of them.
+func (t *TestOutput) ConfigValue(key string) (interface{}, bool) {
+	for i := len(t.opts.configOverrides) - 1; i >= 0; i-- {
+		if c := t.opts.configOverrides[i]; c.Key == key {
+			var value interface{}
+			if err := yaml.Unmarshal([]byte(c.Value), &value); err != nil {
+				return c.Value, true
+			}
+			return value, true
 		}
 	}
-	return false
+	merged, err := t.stagedConfigMap()
+	if err != nil {
+		logrus.WithError(err).Debugf("TestOutput.ConfigValue: can't read staged config")
+		return nil, false
+	}
+	var value interface{} = merged
+	for _, part := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// OutputJSON returns true if Falco was configured to output in JSON format,
+// either with the `-o` option or through its config files (see ConfigValue).
+func (t *TestOutput) OutputJSON() bool {
+	return t.outputJSON
 }
 
 // Err returns a non-nil error in case of issues when running Falco.
@@ -52,14 +97,56 @@ func (t *TestOutput) DurationExceeded() bool {
 	return false
 }
 
-// ExitCode returns the numeric exit code of the Falco process.
+// StopConditionMet returns true if Falco was stopped before terminating
+// on its own because one of the conditions set with WithStopCondition held.
+func (t *TestOutput) StopConditionMet() bool {
+	return t.stopped
+}
+
+// ExitCode returns the numeric exit code of the Falco process, or -1 if
+// the process did not exit normally, such as when terminated by a signal
+// or killed because its run exceeded the deadline (see Result).
 func (t *TestOutput) ExitCode() int {
-	for _, err := range multierr.Errors(t.Err()) {
-		if exitCodeErr, ok := err.(*run.ExitCodeError); ok {
-			return exitCodeErr.Code
-		}
+	return t.Result().ExitCode
+}
+
+// Result returns a description of how the Falco process terminated,
+// including its exit code, the terminating signal, and whether it
+// dumped a core or exceeded its deadline.
+func (t *TestOutput) Result() *run.ProcessResult {
+	return run.ResultFromError(t.err)
+}
+
+// HangDiagnostics returns the diagnostics collected right before killing
+// Falco because its run exceeded the deadline, including the state of its
+// process and threads, its open files, and its last lines of output.
+// Returns nil if the run did not exceed its deadline.
+func (t *TestOutput) HangDiagnostics() *run.HangDiagnostics {
+	return t.hang
+}
+
+// WrapperReport returns the report produced by the instrumentation tool
+// wrapping Falco, such as valgrind or strace. Returns nil if Falco wasn't
+// run with a wrapper runner.
+func (t *TestOutput) WrapperReport() *run.WrapperReport {
+	return t.wrapperReport
+}
+
+// ValgrindReport returns the report of valgrind memcheck, if Falco was run
+// with a wrapper runner using it. Returns nil otherwise.
+func (t *TestOutput) ValgrindReport() *run.ValgrindReport {
+	if t.wrapperReport == nil {
+		return nil
 	}
-	return 0
+	return t.wrapperReport.Valgrind
+}
+
+// CrashArtifacts returns the paths of the files collected after Falco
+// crashed, such as core dumps and the tail of its stderr.
+// Returns nil if Falco did not crash or if crash artifacts collection
+// was not enabled with WithCrashArtifacts.
+func (t *TestOutput) CrashArtifacts() []string {
+	return t.crashArtifacts
 }
 
 // Stdout returns a string containing the stdout output of the Falco run.
@@ -72,6 +159,13 @@ func (t *TestOutput) Stderr() string {
 	return t.stderr.String()
 }
 
+// Journal returns the combined stdout and stderr output of the Falco run,
+// with every line recorded along with its time of arrival and stream of origin.
+// This can be used to check the ordering between lines of different streams.
+func (t *TestOutput) Journal() *run.Journal {
+	return t.journal
+}
+
 // StdoutJSON deserializes the stdout of the Falco run using the JSON encoding.
 // Returns true if the stdout is not encoded as JSON.
 func (t *TestOutput) StdoutJSON() map[string]interface{} {
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// OutputEventKind is the kind of an OutputEvent.
+type OutputEventKind int
+
+const (
+	// OutputEventTimeout is reported by Falco when an alert isn't delivered
+	// within the output_timeout, as all output channels are blocked
+	OutputEventTimeout OutputEventKind = iota
+	// OutputEventQueueDrop is reported by Falco when an alert is dropped,
+	// as the outputs queue reached its capacity
+	OutputEventQueueDrop
+)
+
+func (k OutputEventKind) String() string {
+	switch k {
+	case OutputEventTimeout:
+		return "timeout"
+	case OutputEventQueueDrop:
+		return "queue_drop"
+	default:
+		return fmt.Sprintf("output_event(%d)", int(k))
+	}
+}
+
+// OutputEvent is a backpressure event reported by Falco when its output
+// channels can't keep up with the alerts, such as when they're slow or
+// failing (see WithProgramDelay and WithHTTPResponseDelay).
+type OutputEvent struct {
+	Kind OutputEventKind
+	//
+	// Time is the instant in which the event was received, or the zero
+	// time if the event was parsed from a standalone line
+	Time time.Time
+	//
+	// Payload is the description of the blocked output reported by Falco
+	// along with a timeout, if any
+	Payload string
+	Line    string
+}
+
+// OutputEvents represents a list of output events.
+type OutputEvents []*OutputEvent
+
+var (
+	outputTimeoutRegex   = regexp.MustCompile(`(?i)(?:"(.*)"\.?\s+)?output timeout, all output channels are blocked`)
+	outputQueueDropRegex = regexp.MustCompile(`(?i)outputs queue out of memory`)
+)
+
+// ParseOutputEvent parses an output event from a Falco log line.
+// Returns an error if the line doesn't report any output event.
+func ParseOutputEvent(line string) (*OutputEvent, error) {
+	if m := outputTimeoutRegex.FindStringSubmatch(line); m != nil {
+		return &OutputEvent{Kind: OutputEventTimeout, Payload: m[1], Line: line}, nil
+	}
+	if outputQueueDropRegex.MatchString(line) {
+		return &OutputEvent{Kind: OutputEventQueueDrop, Line: line}, nil
+	}
+	return nil, fmt.Errorf("not an output event: %s", line)
+}
+
+// OutputEvents returns the output events reported by Falco during the run,
+// in order of arrival.
+func (t *TestOutput) OutputEvents() OutputEvents {
+	var res OutputEvents
+	for _, entry := range t.journal.Entries() {
+		if e, err := ParseOutputEvent(entry.Line); err == nil {
+			e.Time = entry.Time
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// OfKind returns the list of events of the given kind.
+func (e OutputEvents) OfKind(k OutputEventKind) OutputEvents {
+	var res OutputEvents
+	for _, event := range e {
+		if event.Kind == k {
+			res = append(res, event)
+		}
+	}
+	return res
+}
+
+// Timeouts returns the list of output timeout events.
+func (e OutputEvents) Timeouts() OutputEvents {
+	return e.OfKind(OutputEventTimeout)
+}
+
+// QueueDrops returns the list of queue drop events.
+func (e OutputEvents) QueueDrops() OutputEvents {
+	return e.OfKind(OutputEventQueueDrop)
+}
+
+// Count returns the amount of events in the list.
+func (e OutputEvents) Count() int {
+	return len(e)
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/falcosecurity/testing/pkg/run"
+)
+
+var (
+	configFileLogRegex       = regexp.MustCompile(`configuration file: (\S+)`)
+	configFileSchemaLogRegex = regexp.MustCompile(`^\s*(\S+) \| schema validation: (\S+)`)
+)
+
+// LoadedConfigFile is a configuration file that Falco reported as loaded.
+type LoadedConfigFile struct {
+	Path string
+	// SchemaValidation is the outcome of the config schema validation
+	// (e.g. "ok"), or empty if not reported by Falco
+	SchemaValidation string
+}
+
+// LoadedConfigFiles returns the list of configuration files that Falco
+// reported as loaded in its logs, in the order in which they got loaded.
+func (t *TestOutput) LoadedConfigFiles() []*LoadedConfigFile {
+	var res []*LoadedConfigFile
+	seen := make(map[string]bool)
+	lines, _ := readLineByLine(strings.NewReader(t.Stderr()))
+	for _, line := range lines {
+		var f *LoadedConfigFile
+		if m := configFileSchemaLogRegex.FindStringSubmatch(line); m != nil {
+			f = &LoadedConfigFile{Path: m[1], SchemaValidation: m[2]}
+		} else if m := configFileLogRegex.FindStringSubmatch(line); m != nil {
+			f = &LoadedConfigFile{Path: m[1]}
+		}
+		if f != nil && !seen[f.Path] {
+			seen[f.Path] = true
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// StagedConfig returns an approximation of the configuration loaded by
+// Falco, computed on the host by merging on top of the main config file
+// all the includes staged with WithConfigIncludes and WithConfigIncludeDir,
+// in the same order used by Falco. This is not reported by Falco itself:
+// settings overridden with the `-o` option, includes declared by the main
+// config file but not staged by the test, and the files actually visible
+// to runners with their own filesystem (e.g. docker) are not accounted for.
+// Use LoadedConfigFiles to check what Falco reported as loaded.
+func (t *TestOutput) StagedConfig() (*Config, error) {
+	return t.stagedConfigBuilder().Config()
+}
+
+func (t *TestOutput) stagedConfigMap() (map[string]interface{}, error) {
+	if t.stagedConfig == nil {
+		m, err := t.stagedConfigBuilder().Map()
+		if err != nil {
+			return nil, err
+		}
+		t.stagedConfig = m
+	}
+	return t.stagedConfig, nil
+}
+
+func (t *TestOutput) stagedConfigBuilder() *ConfigBuilder {
+	builder := NewConfigBuilder().WithFile(t.opts.mainConfig())
+	for _, include := range t.opts.configIncludes {
+		for _, f := range t.opts.configIncludeFiles(include) {
+			builder.WithFile(f)
+		}
+	}
+	return builder
+}
+
+// configIncludeFiles returns the staged files matching the given config
+// include, which can either be a single file or a directory of files
+// sorted by name.
+func (o *testOptions) configIncludeFiles(include string) []run.FileAccessor {
+	var res []run.FileAccessor
+	for _, f := range o.files {
+		if f.Name() == include {
+			return []run.FileAccessor{f}
+		}
+		if path.Dir(f.Name()) == include {
+			res = append(res, f)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name() < res[j].Name()
+	})
+	return res
+}
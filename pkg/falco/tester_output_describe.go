@@ -103,7 +103,7 @@ type RuleInfoDescription struct {
 	Enabled     bool     `json:"enabled"`
 	Name        string   `json:"name"`
 	Output      string   `json:"output"`
-	Priority    string   `json:"priority"`
+	Priority    Priority `json:"priority"`
 	Source      string   `json:"source"`
 	Tags        []string `json:"tags"`
 }
@@ -118,7 +118,7 @@ type RuleDescription struct {
 // This is achieved with the Falco `-L` option combined with the JSON output enabled.
 // Returns nil if Falco wasn't run for rules descriptions.
 func (t *TestOutput) RulesetDescription() *RulesetDescription {
-	if !t.hasOutputJSON() {
+	if !t.OutputJSON() {
 		logrus.Errorf("TestOutput.RulesetDescription: must use WithOutputJSON")
 	}
 
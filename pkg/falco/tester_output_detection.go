@@ -20,19 +20,28 @@ package falco
 
 import (
 	"encoding/json"
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	textAlertTimeLayout        = "15:04:05.999999999"
+	textAlertTimeLayoutISO8601 = "2006-01-02T15:04:05.999999999Z0700"
+)
+
+var textAlertRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{4})|\d{2}:\d{2}:\d{2}(?:\.\d+)?): ([A-Za-z]+) `)
+
 // Alert represent an alert produced by a Falco rule.
 type Alert struct {
 	Time         time.Time              `json:"time"`
 	Rule         string                 `json:"rule"`
 	Output       string                 `json:"output"`
-	Priority     string                 `json:"priority"`
+	Priority     Priority               `json:"priority"`
 	Source       string                 `json:"source"`
 	Hostname     string                 `json:"hostname"`
 	Tags         []string               `json:"tags"`
@@ -43,27 +52,82 @@ type Alert struct {
 type Detections []*Alert
 
 // Detections converts the output of the Falco run into a list of rule detections.
-// Returns nil if Falco wasn't run for rules detection.
+// Alerts are parsed from stdout either in JSON format (see WithOutputJSON)
+// or in text format (see ParseTextAlert). Returns nil if Falco wasn't run
+// for rules detection.
 func (t *TestOutput) Detections() Detections {
-	if !t.hasOutputJSON() {
-		logrus.Errorf("TestOutput.Detections: must use WithOutputJSON")
-	}
-
-	lines, err := readLineByLine(strings.NewReader(t.Stdout()))
+	res, err := ParseDetections(t.Stdout())
 	if err != nil {
 		logrus.WithError(err).Errorf("TestOutput.Detections: can't read stdout line by line")
 		return nil
 	}
+	return res
+}
+
+// ParseDetections parses a list of rule detections from the given Falco
+// output, such as the content of a file written with the file output.
+// Each line is parsed as an alert either in JSON or in text format, and
+// lines not representing an alert are ignored.
+func ParseDetections(output string) (Detections, error) {
+	lines, err := readLineByLine(strings.NewReader(output))
+	if err != nil {
+		return nil, err
+	}
 	var res Detections
 	for _, line := range lines {
-		alert := Alert{}
-		if err := json.Unmarshal([]byte(line), &alert); err != nil {
-			logrus.WithField("line", line).Tracef("TestOutput.Detections: stdout line not JSON")
+		alert, err := parseAlert(line)
+		if err != nil {
+			logrus.WithField("line", line).Tracef("ParseDetections: output line not an alert")
 			continue
 		}
-		res = append(res, &alert)
+		res = append(res, alert)
 	}
-	return res
+	return res, nil
+}
+
+// parseAlert parses a Falco alert from an output line either in JSON
+// or in text format.
+func parseAlert(line string) (*Alert, error) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return ParseTextAlert(line)
+	}
+	alert := &Alert{}
+	if err := json.Unmarshal([]byte(line), alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// ParseTextAlert parses a Falco alert from an output line in text format,
+// such as "16:17:57.881781397: Warning An open was seen (command=cat)".
+// Both the ISO 8601 time format (see Config.TimeFormatISO8601) and the
+// default one are supported. The default time format carries no date, so
+// the alert time refers to January 1 of year zero in that case. Text
+// alerts carry no rule name, source, hostname, tags, or output fields,
+// and their output is the whole line, as in the JSON format.
+func ParseTextAlert(line string) (*Alert, error) {
+	line = strings.TrimSuffix(line, "\r")
+	match := textAlertRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("not an alert in text format: %s", line)
+	}
+	layout := textAlertTimeLayout
+	if strings.Contains(match[1], "T") {
+		layout = textAlertTimeLayoutISO8601
+	}
+	t, err := time.Parse(layout, match[1])
+	if err != nil {
+		return nil, err
+	}
+	priority, err := ParsePriority(match[2])
+	if err != nil {
+		return nil, err
+	}
+	return &Alert{
+		Time:     t,
+		Priority: priority,
+		Output:   line,
+	}, nil
 }
 
 func (d Detections) filter(f func(*Alert) bool) Detections {
@@ -77,11 +141,35 @@ func (d Detections) filter(f func(*Alert) bool) Detections {
 }
 
 // OfPriority returns the list of detections that have a given priority.
-func (d Detections) OfPriority(p string) Detections {
+// The priority can either be a Priority or a string, parsed with
+// ParsePriority (e.g. "INFO" or "Informational"). If the priority can't
+// be parsed, an error is logged and no detection is returned.
+func (d Detections) OfPriority(v interface{}) Detections {
+	p, err := toPriority(v)
+	if err != nil {
+		logrus.WithError(err).Error("Detections.OfPriority: invalid priority")
+		return nil
+	}
+	return d.filter(func(a *Alert) bool {
+		return a.Priority == p
+	})
+}
+
+// AtLeast returns the list of detections that have a priority at least
+// as severe as the given one (e.g. AtLeast(PriorityWarning) includes
+// Warning, Error, Critical, Alert, and Emergency).
+func (d Detections) AtLeast(p Priority) Detections {
+	return d.filter(func(a *Alert) bool {
+		return a.Priority != PriorityUnknown && a.Priority >= p
+	})
+}
+
+// AtMost returns the list of detections that have a priority at most
+// as severe as the given one (e.g. AtMost(PriorityNotice) includes
+// Notice, Informational, and Debug).
+func (d Detections) AtMost(p Priority) Detections {
 	return d.filter(func(a *Alert) bool {
-		// note: we need to use "CONTAINS" because of
-		// the INFO -> INFORMATIONAL changes we had in the past
-		return strings.Contains(strings.ToLower(a.Priority), strings.ToLower(p))
+		return a.Priority != PriorityUnknown && a.Priority <= p
 	})
 }
 
@@ -89,17 +177,285 @@ func (d Detections) OfPriority(p string) Detections {
 // The rule name can either be a string or a *regexp.Regexp.
 func (d Detections) OfRule(v interface{}) Detections {
 	return d.filter(func(a *Alert) bool {
-		if rgx, ok := v.(*regexp.Regexp); ok {
-			return rgx.MatchString(a.Rule)
+		return stringMatches(v, a.Rule)
+	})
+}
+
+// OfSource returns the list of detections that have a given event source.
+// The source can either be a string or a *regexp.Regexp.
+func (d Detections) OfSource(v interface{}) Detections {
+	return d.filter(func(a *Alert) bool {
+		return stringMatches(v, a.Source)
+	})
+}
+
+// OfHostname returns the list of detections that have a given hostname.
+// The hostname can either be a string or a *regexp.Regexp.
+func (d Detections) OfHostname(v interface{}) Detections {
+	return d.filter(func(a *Alert) bool {
+		return stringMatches(v, a.Hostname)
+	})
+}
+
+// OfTags returns the list of detections that have all the given tags.
+func (d Detections) OfTags(tags ...string) Detections {
+	return d.filter(func(a *Alert) bool {
+		for _, tag := range tags {
+			found := false
+			for _, t := range a.Tags {
+				if t == tag {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// InTimeRange returns the list of detections of which time is in the
+// closed interval between 'from' and 'to'. A zero value on either of
+// the two ends leaves the interval unbounded on that side.
+func (d Detections) InTimeRange(from, to time.Time) Detections {
+	return d.filter(func(a *Alert) bool {
+		return (from.IsZero() || !a.Time.Before(from)) && (to.IsZero() || !a.Time.After(to))
+	})
+}
+
+// OfOutputField returns the list of detections that have an output field
+// with the given name and value. The value can either be a string, compared
+// with the textual representation of the field, a *regexp.Regexp, matched
+// against the textual representation of the field, a number, compared
+// numerically, or nil, matching fields with a null value.
+func (d Detections) OfOutputField(name string, v interface{}) Detections {
+	return d.filter(func(a *Alert) bool {
+		field, ok := a.OutputFields[name]
+		if !ok {
+			return false
 		}
-		if str, ok := v.(string); ok {
-			return a.Rule == str
+		switch value := v.(type) {
+		case nil:
+			return field == nil
+		case string, *regexp.Regexp:
+			return field != nil && stringMatches(v, fmt.Sprint(field))
+		default:
+			n, ok := toFloat64(value)
+			if !ok {
+				panic("argument must be string, *regexp.Regexp, number, or nil")
+			}
+			f, ok := toFloat64(field)
+			return ok && f == n
 		}
-		panic("argument must be string or *regexp.Regexp")
 	})
 }
 
+// OfOutputFieldCompare returns the list of detections that have a numeric
+// output field with the given name, of which value compares with the
+// given number according to the operator. The supported operators are
+// "==", "!=", "<", "<=", ">", and ">=".
+func (d Detections) OfOutputFieldCompare(name, op string, n float64) Detections {
+	var cmp func(float64) bool
+	switch op {
+	case "==":
+		cmp = func(f float64) bool { return f == n }
+	case "!=":
+		cmp = func(f float64) bool { return f != n }
+	case "<":
+		cmp = func(f float64) bool { return f < n }
+	case "<=":
+		cmp = func(f float64) bool { return f <= n }
+	case ">":
+		cmp = func(f float64) bool { return f > n }
+	case ">=":
+		cmp = func(f float64) bool { return f >= n }
+	default:
+		panic(fmt.Sprintf("unsupported comparison operator: %s", op))
+	}
+	return d.filter(func(a *Alert) bool {
+		f, ok := toFloat64(a.OutputFields[name])
+		return ok && cmp(f)
+	})
+}
+
+// GroupBy groups the detections by the key returned by the given function
+// for each alert. The order of the alerts in each group is preserved.
+func (d Detections) GroupBy(key func(*Alert) string) map[string]Detections {
+	res := make(map[string]Detections)
+	for _, a := range d {
+		k := key(a)
+		res[k] = append(res[k], a)
+	}
+	return res
+}
+
+// GroupByRule groups the detections by rule name.
+func (d Detections) GroupByRule() map[string]Detections {
+	return d.GroupBy(func(a *Alert) string { return a.Rule })
+}
+
+// CountByRule returns the amount of detections for each rule name.
+func (d Detections) CountByRule() map[string]int {
+	return countGroups(d.GroupByRule())
+}
+
+// CountByPriority returns the amount of detections for each priority.
+func (d Detections) CountByPriority() map[Priority]int {
+	res := make(map[Priority]int)
+	for _, a := range d {
+		res[a.Priority]++
+	}
+	return res
+}
+
+// FirstBy returns the earliest alert in time for each key returned by the
+// given function, such as the rule name or the value of an output field.
+func (d Detections) FirstBy(key func(*Alert) string) map[string]*Alert {
+	res := make(map[string]*Alert)
+	for k, group := range d.GroupBy(key) {
+		res[k] = group.First()
+	}
+	return res
+}
+
+// LastBy returns the latest alert in time for each key returned by the
+// given function, such as the rule name or the value of an output field.
+func (d Detections) LastBy(key func(*Alert) string) map[string]*Alert {
+	res := make(map[string]*Alert)
+	for k, group := range d.GroupBy(key) {
+		res[k] = group.Last()
+	}
+	return res
+}
+
+// First returns the earliest alert in time, or nil if the list is empty.
+// Alerts with the same time are ordered by their appearance in the list.
+func (d Detections) First() *Alert {
+	sorted := d.SortedByTime()
+	if len(sorted) == 0 {
+		return nil
+	}
+	return sorted[0]
+}
+
+// Last returns the latest alert in time, or nil if the list is empty.
+// Alerts with the same time are ordered by their appearance in the list.
+func (d Detections) Last() *Alert {
+	sorted := d.SortedByTime()
+	if len(sorted) == 0 {
+		return nil
+	}
+	return sorted[len(sorted)-1]
+}
+
+// SortedByTime returns a copy of the list of detections sorted by time.
+// Alerts with the same time are ordered by their appearance in the list.
+func (d Detections) SortedByTime() Detections {
+	res := make(Detections, len(d))
+	copy(res, d)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Time.Before(res[j].Time)
+	})
+	return res
+}
+
+// Sequence returns true if the detections contain a sequence of alerts
+// matching the given steps in order of time, such that the time elapsed
+// between the first and the last alert of the sequence is at most 'within'.
+// A zero 'within' does not bound the duration of the sequence. Each step
+// can either be a rule name as a string or a *regexp.Regexp, or a
+// func(*Alert) bool predicate. For example, "rule A then rule B within 1s"
+// is expressed as Sequence(time.Second, "A", "B").
+func (d Detections) Sequence(within time.Duration, steps ...interface{}) bool {
+	if len(steps) == 0 {
+		return true
+	}
+	sorted := d.SortedByTime()
+	for i, first := range sorted {
+		if !alertMatches(steps[0], first) {
+			continue
+		}
+		// for a given first alert, greedily matching the earliest alert
+		// for each step minimizes the duration of the sequence
+		last, step := first, 1
+		for _, a := range sorted[i+1:] {
+			if step == len(steps) {
+				break
+			}
+			if alertMatches(steps[step], a) {
+				last = a
+				step++
+			}
+		}
+		if step == len(steps) && (within == 0 || last.Time.Sub(first.Time) <= within) {
+			return true
+		}
+	}
+	return false
+}
+
 // Count returns the amount of alerts in the list of detections.
 func (d Detections) Count() int {
 	return len(d)
 }
+
+func countGroups(groups map[string]Detections) map[string]int {
+	res := make(map[string]int)
+	for k, group := range groups {
+		res[k] = group.Count()
+	}
+	return res
+}
+
+func stringMatches(v interface{}, s string) bool {
+	if rgx, ok := v.(*regexp.Regexp); ok {
+		return rgx.MatchString(s)
+	}
+	if str, ok := v.(string); ok {
+		return s == str
+	}
+	panic("argument must be string or *regexp.Regexp")
+}
+
+func alertMatches(v interface{}, a *Alert) bool {
+	if f, ok := v.(func(*Alert) bool); ok {
+		return f(a)
+	}
+	return stringMatches(v, a.Rule)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDetectionsJSON = `
+{"time":"2023-01-01T00:00:00.000Z","rule":"A","priority":"Warning","source":"syscall","hostname":"h1","tags":["t1","t2"],"output_fields":{"proc.name":"cat","fd.num":3}}
+{"time":"2023-01-01T00:00:00.500Z","rule":"B","priority":"Notice","source":"syscall","hostname":"h1","tags":["t2"],"output_fields":{"proc.name":"ls","fd.num":5}}
+{"time":"2023-01-01T00:00:03.000Z","rule":"A","priority":"Warning","source":"syscall","hostname":"h2","tags":["t1"],"output_fields":{"proc.name":"cat","fd.num":null}}
+{"time":"2023-01-01T00:00:02.000Z","rule":"C","priority":"Critical","source":"k8s_audit","hostname":"h2","output_fields":{"ka.verb":"create"}}
+{"time":"2023-01-01T00:00:05.000Z","rule":"B","priority":"Notice","source":"syscall","hostname":"h1","tags":["t2"],"output_fields":{"proc.name":"ls","fd.num":7}}
+`
+
+func testDetections(t *testing.T) Detections {
+	var res Detections
+	for _, line := range strings.Split(strings.TrimSpace(testDetectionsJSON), "\n") {
+		a, err := parseAlert(line)
+		require.Nil(t, err)
+		res = append(res, a)
+	}
+	return res
+}
+
+func TestDetectionsQuery(t *testing.T) {
+	d := testDetections(t)
+	require.Equal(t, 4, d.OfSource("syscall").Count())
+	require.Equal(t, 3, d.OfHostname("h1").Count())
+	require.Equal(t, 5, d.OfHostname(regexp.MustCompile(`^h\d$`)).Count())
+	require.Equal(t, 2, d.OfTags("t1").Count())
+	require.Equal(t, 1, d.OfTags("t1", "t2").Count())
+	require.Equal(t, 3, d.InTimeRange(
+		time.Date(2023, 1, 1, 0, 0, 0, 500*int(time.Millisecond), time.UTC),
+		time.Date(2023, 1, 1, 0, 0, 3, 0, time.UTC)).Count())
+	require.Equal(t, 2, d.InTimeRange(time.Date(2023, 1, 1, 0, 0, 3, 0, time.UTC), time.Time{}).Count())
+	require.Equal(t, 2, d.OfOutputField("proc.name", "cat").Count())
+	require.Equal(t, 4, d.OfOutputField("proc.name", regexp.MustCompile(`^(cat|ls)$`)).Count())
+	require.Equal(t, 1, d.OfOutputField("fd.num", 5).Count())
+	require.Equal(t, 1, d.OfOutputField("fd.num", nil).Count())
+	require.Equal(t, 2, d.OfOutputFieldCompare("fd.num", ">", 3).Count())
+	require.Equal(t, 3, d.OfOutputFieldCompare("fd.num", "<=", 7).Count())
+	require.Panics(t, func() { d.OfOutputFieldCompare("fd.num", "~", 0) })
+	require.Panics(t, func() { d.OfOutputField("fd.num", true) })
+}
+
+func TestDetectionsAggregations(t *testing.T) {
+	d := testDetections(t)
+	require.Len(t, d.GroupByRule(), 3)
+	require.Equal(t, map[string]int{"A": 2, "B": 2, "C": 1}, d.CountByRule())
+	require.Equal(t, map[Priority]int{PriorityWarning: 2, PriorityNotice: 2, PriorityCritical: 1}, d.CountByPriority())
+	require.Equal(t, "C", d.SortedByTime()[2].Rule)
+	require.Equal(t, "A", d.First().Rule)
+	require.Equal(t, "B", d.Last().Rule)
+	require.Nil(t, Detections{}.First())
+
+	byHost := func(a *Alert) string { return a.Hostname }
+	require.Equal(t, "A", d.FirstBy(byHost)["h1"].Rule)
+	require.Equal(t, "C", d.FirstBy(byHost)["h2"].Rule)
+	require.Equal(t, "A", d.LastBy(byHost)["h2"].Rule)
+}
+
+func TestDetectionsSequence(t *testing.T) {
+	d := testDetections(t)
+	require.True(t, d.Sequence(time.Second, "A", "B"))
+	require.False(t, d.Sequence(time.Second, "B", "A"))
+	require.True(t, d.Sequence(0, "B", "A"))
+	require.True(t, d.Sequence(3*time.Second, "C", "A", "B"))
+	require.False(t, d.Sequence(2*time.Second, "C", "A", "B"))
+	require.True(t, d.Sequence(0, "A", func(a *Alert) bool { return a.Source == "k8s_audit" }))
+	require.False(t, d.Sequence(0, "A", "D"))
+	require.True(t, d.Sequence(time.Second))
+}
+
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectations(t *testing.T) {
+	d := testDetections(t)
+	res := (&Expectations{
+		Rules: []RuleExpectation{
+			{Rule: "A", Count: Ptr(2), Priority: PriorityWarning, OutputFields: map[string]interface{}{"proc.name": "cat"}},
+			{Rule: regexp.MustCompile(`^B$`), Min: Ptr(1), Max: Ptr(2), RequiredOutputFields: []string{"fd.num"}},
+		},
+	}).Evaluate(d)
+	require.True(t, res.Ok(), res.String())
+
+	res = (&Expectations{
+		Rules: []RuleExpectation{
+			{Rule: "A", Count: Ptr(1), RequiredOutputFields: []string{"fd.num"}},
+			{Rule: "B", Priority: PriorityCritical},
+			{Rule: "D"},
+		},
+		NoOtherRules: true,
+	}).Evaluate(d)
+	require.False(t, res.Ok())
+	require.Len(t, res.Rows, 4)
+	require.Equal(t, []string{"count is 2, expected 1"}, res.Rows[0].Failures)
+	require.Equal(t, []string{"2 detections with other priority"}, res.Rows[1].Failures)
+	require.Equal(t, []string{"no detection"}, res.Rows[2].Failures)
+	require.Equal(t, "C", res.Rows[3].Rule)
+	require.Equal(t, "count=2 Notice:2", res.Rows[1].Actual)
+	lines := strings.Split(strings.TrimSpace(res.String()), "\n")
+	require.Len(t, lines, 5)
+	require.Regexp(t, `^RULE\s+EXPECTED\s+ACTUAL\s+RESULT$`, lines[0])
+	require.Regexp(t, `^B\s+min=1 priority=Critical\s+count=2 Notice:2\s+FAIL: 2 detections with other priority$`, lines[2])
+
+	runner := newFakeFalcoRunner(t, `echo '{"rule":"A","priority":"Warning"}'`)
+	out := Test(runner, WithOutputJSON())
+	tb := &recordingTB{TB: t}
+	require.True(t, out.Expect(tb, &Expectations{Rules: []RuleExpectation{{Rule: "A", Count: Ptr(1)}}}))
+	require.Empty(t, tb.errors)
+	require.False(t, out.Expect(tb, &Expectations{Rules: []RuleExpectation{{Rule: "B"}}}))
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], "detection expectations not met")
+}
+
+func TestPriority(t *testing.T) {
+	for s, expected := range map[string]Priority{
+		"EMERGENCY":     PriorityEmergency,
+		"Alert":         PriorityAlert,
+		"critical":      PriorityCritical,
+		"ERROR":         PriorityError,
+		"warn":          PriorityWarning,
+		"Notice":        PriorityNotice,
+		"INFO":          PriorityInformational,
+		"informational": PriorityInformational,
+		"DEBUG":         PriorityDebug,
+	} {
+		p, err := ParsePriority(s)
+		require.Nil(t, err)
+		require.Equal(t, expected, p, s)
+	}
+	_, err := ParsePriority("severe")
+	require.Error(t, err)
+	require.True(t, PriorityWarning > PriorityNotice)
+	require.True(t, PriorityEmergency > PriorityAlert)
+	require.Equal(t, "Informational", PriorityInformational.String())
+
+	d := testDetections(t)
+	require.Equal(t, 2, d.OfPriority("WARNING").Count())
+	require.Equal(t, 2, d.OfPriority(PriorityNotice).Count())
+	require.Equal(t, 3, d.AtLeast(PriorityWarning).Count())
+	require.Equal(t, 2, d.AtMost(PriorityNotice).Count())
+	require.Equal(t, 0, d.AtLeast(PriorityAlert).Count())
+	require.Empty(t, d.OfPriority("severe"))
+	require.Empty(t, d.OfPriority(42))
+
+	// alerts with an unknown priority must not be discarded
+	a, err := parseAlert(`{"rule":"A","priority":"Severe","output":"x"}`)
+	require.Nil(t, err)
+	require.Equal(t, PriorityUnknown, a.Priority)
+	require.Equal(t, "A", a.Rule)
+
+	b, err := PriorityCritical.MarshalYAML()
+	require.Nil(t, err)
+	require.Equal(t, "critical", b)
+	config, err := NewConfigBuilder().WithYAML("priority: INFO\n").Config()
+	require.Nil(t, err)
+	require.Equal(t, PriorityInformational, config.Priority)
+	config, err = NewConfigBuilder().WithYAML("priority: severe\n").Config()
+	require.Nil(t, err)
+	require.Equal(t, PriorityUnknown, config.Priority)
+}
+
+func TestTextAlerts(t *testing.T) {
+	a, err := ParseTextAlert("2016-08-04T16:17:57.881781397+0000: Warning An open was seen (command=cat /dev/null)")
+	require.Nil(t, err)
+	require.Equal(t, PriorityWarning, a.Priority)
+	require.True(t, a.Time.Equal(time.Date(2016, 8, 4, 16, 17, 57, 881781397, time.UTC)))
+	require.Equal(t, "2016-08-04T16:17:57.881781397+0000: Warning An open was seen (command=cat /dev/null)", a.Output)
+
+	a, err = ParseTextAlert("16:17:57.881781397: Informational An open was seen")
+	require.Nil(t, err)
+	require.Equal(t, PriorityInformational, a.Priority)
+	require.Equal(t, 16, a.Time.Hour())
+	require.Equal(t, 881781397, a.Time.Nanosecond())
+
+	_, err = ParseTextAlert("Events detected: 8")
+	require.Error(t, err)
+	_, err = ParseTextAlert("16:17:57.881781397: Severe not a priority")
+	require.Error(t, err)
+
+	d, err := ParseDetections(`16:17:57.881781397: Warning An open was seen
+{"rule":"A","priority":"Error","output":"json alert"}
+Events detected: 2
+Rule counts by severity:
+   WARNING: 1
+16:17:58.000000000: Notice Another alert
+`)
+	require.Nil(t, err)
+	require.Equal(t, 3, d.Count())
+	require.Equal(t, 1, d.OfRule("A").Count())
+	require.Equal(t, 2, d.AtLeast(PriorityWarning).Count())
+	require.True(t, d.Sequence(2*time.Second, func(a *Alert) bool { return a.Priority == PriorityWarning },
+		func(a *Alert) bool { return a.Priority == PriorityNotice }))
+}
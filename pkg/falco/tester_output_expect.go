@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+// RuleExpectation describes the detections expected for a given rule.
+// If none of Count, Min, and Max are set, at least one detection is expected.
+type RuleExpectation struct {
+	// Rule is the rule name, either as a string or a *regexp.Regexp
+	Rule interface{}
+	//
+	// Count is the exact amount of expected detections
+	Count *int
+	//
+	// Min is the minimum amount of expected detections
+	Min *int
+	//
+	// Max is the maximum amount of expected detections
+	Max *int
+	//
+	// Priority is the priority that all the detections must have
+	Priority Priority
+	//
+	// RequiredOutputFields are the output fields that all the detections
+	// must have, regardless of their value
+	RequiredOutputFields []string
+	//
+	// OutputFields are the output fields values that all the detections
+	// must have, with the same semantics of Detections.OfOutputField
+	OutputFields map[string]interface{}
+}
+
+// Expectations is a declarative specification of the detections expected
+// from a Falco run.
+type Expectations struct {
+	Rules []RuleExpectation
+	//
+	// NoOtherRules requires no detection for rules not listed in Rules
+	NoOtherRules bool
+}
+
+// ExpectationRow is the outcome of a single expectation, as reported in
+// the table of an ExpectationsResult.
+type ExpectationRow struct {
+	Rule     string
+	Expected string
+	Actual   string
+	Failures []string
+}
+
+// Ok returns true if the expectation is met.
+func (r *ExpectationRow) Ok() bool {
+	return len(r.Failures) == 0
+}
+
+// ExpectationsResult is the outcome of evaluating Expectations against
+// a list of detections.
+type ExpectationsResult struct {
+	Rows []*ExpectationRow
+}
+
+// Ok returns true if all the expectations are met.
+func (r *ExpectationsResult) Ok() bool {
+	for _, row := range r.Rows {
+		if !row.Ok() {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a table comparing the expected and the actual detections.
+func (r *ExpectationsResult) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tEXPECTED\tACTUAL\tRESULT")
+	for _, row := range r.Rows {
+		result := "ok"
+		if !row.Ok() {
+			result = "FAIL: " + strings.Join(row.Failures, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Rule, row.Expected, row.Actual, result)
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// Evaluate evaluates the expectations against the given detections.
+func (e *Expectations) Evaluate(d Detections) *ExpectationsResult {
+	res := &ExpectationsResult{}
+	matched := make(map[*Alert]bool)
+	for _, r := range e.Rules {
+		detections := d.OfRule(r.Rule)
+		for _, a := range detections {
+			matched[a] = true
+		}
+		res.Rows = append(res.Rows, r.evaluate(detections))
+	}
+	if e.NoOtherRules {
+		others := d.filter(func(a *Alert) bool { return !matched[a] })
+		for _, rule := range sortedKeys(others.CountByRule()) {
+			row := &ExpectationRow{
+				Rule:     rule,
+				Expected: "count=0",
+				Actual:   describeDetections(others.OfRule(rule)),
+			}
+			row.Failures = append(row.Failures, "unexpected rule")
+			res.Rows = append(res.Rows, row)
+		}
+	}
+	return res
+}
+
+func (r *RuleExpectation) evaluate(d Detections) *ExpectationRow {
+	row := &ExpectationRow{
+		Rule:   ruleString(r.Rule),
+		Actual: describeDetections(d),
+	}
+	var expected []string
+	count := d.Count()
+	if r.Count == nil && r.Min == nil && r.Max == nil {
+		expected = append(expected, "min=1")
+		if count < 1 {
+			row.Failures = append(row.Failures, "no detection")
+		}
+	}
+	if r.Count != nil {
+		expected = append(expected, fmt.Sprintf("count=%d", *r.Count))
+		if count != *r.Count {
+			row.Failures = append(row.Failures, fmt.Sprintf("count is %d, expected %d", count, *r.Count))
+		}
+	}
+	if r.Min != nil {
+		expected = append(expected, fmt.Sprintf("min=%d", *r.Min))
+		if count < *r.Min {
+			row.Failures = append(row.Failures, fmt.Sprintf("count is %d, expected at least %d", count, *r.Min))
+		}
+	}
+	if r.Max != nil {
+		expected = append(expected, fmt.Sprintf("max=%d", *r.Max))
+		if count > *r.Max {
+			row.Failures = append(row.Failures, fmt.Sprintf("count is %d, expected at most %d", count, *r.Max))
+		}
+	}
+	if r.Priority != PriorityUnknown {
+		expected = append(expected, "priority="+r.Priority.String())
+		if n := count - d.OfPriority(r.Priority).Count(); n > 0 {
+			row.Failures = append(row.Failures, fmt.Sprintf("%d detections with other priority", n))
+		}
+	}
+	for _, field := range r.RequiredOutputFields {
+		expected = append(expected, "has "+field)
+		n := d.filter(func(a *Alert) bool {
+			_, ok := a.OutputFields[field]
+			return !ok
+		}).Count()
+		if n > 0 {
+			row.Failures = append(row.Failures, fmt.Sprintf("%d detections without %s", n, field))
+		}
+	}
+	for _, field := range sortedKeys(r.OutputFields) {
+		value := r.OutputFields[field]
+		expected = append(expected, fmt.Sprintf("%s=%s", field, matcherString(value)))
+		if n := count - d.OfOutputField(field, value).Count(); n > 0 {
+			row.Failures = append(row.Failures, fmt.Sprintf("%d detections with other %s", n, field))
+		}
+	}
+	row.Expected = strings.Join(expected, " ")
+	return row
+}
+
+// Expect evaluates the given expectations against the detections of the
+// Falco run, and reports a test error with a table comparing the expected
+// and the actual detections if any of them is not met. Returns true if
+// all the expectations are met.
+func (t *TestOutput) Expect(tb testing.TB, e *Expectations) bool {
+	tb.Helper()
+	res := e.Evaluate(t.Detections())
+	if !res.Ok() {
+		tb.Errorf("detection expectations not met:\n%s", res.String())
+		return false
+	}
+	return true
+}
+
+func describeDetections(d Detections) string {
+	res := fmt.Sprintf("count=%d", d.Count())
+	priorities := d.CountByPriority()
+	for p := PriorityEmergency; p >= PriorityUnknown; p-- {
+		if n, ok := priorities[p]; ok {
+			res += fmt.Sprintf(" %s:%d", p, n)
+		}
+	}
+	return res
+}
+
+func ruleString(v interface{}) string {
+	if str, ok := v.(string); ok {
+		return str
+	}
+	return matcherString(v)
+}
+
+func matcherString(v interface{}) string {
+	if rgx, ok := v.(*regexp.Regexp); ok {
+		return "/" + rgx.String() + "/"
+	}
+	if str, ok := v.(string); ok {
+		return fmt.Sprintf("%q", str)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	var res []string
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
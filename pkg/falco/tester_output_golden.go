@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// GoldenDir is the directory in which golden files are stored
+	GoldenDir = "testdata"
+	// GoldenFS is an optional file system from which golden files are
+	// read in place of GoldenDir, such as one embedded in a test binary
+	GoldenFS fs.FS = nil
+	// UpdateGolden makes golden snapshots be written into GoldenDir
+	// instead of being compared with the existing golden files
+	UpdateGolden = false
+)
+
+const (
+	// GoldenHostname is the placeholder of normalized hostnames
+	GoldenHostname = "<hostname>"
+	//
+	// GoldenTime is the placeholder of normalized wall-clock times
+	GoldenTime = "<time>"
+)
+
+var (
+	goldenTimeRegex    = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?|\b\d{2}:\d{2}:\d{2}\.\d{9}\b`)
+	goldenRawTimeRegex = regexp.MustCompile(`("evt\.(?:raw)?time[^"]*"\s*:\s*)\d+`)
+	goldenHostRegex    = regexp.MustCompile(`("hostname"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	goldenNameRegex    = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+	goldenTimeFields   = []string{"evt.time", "evt.rawtime", "evt.datetime"}
+	errGoldenNotFound  = errors.New("golden file not found, run with -update to create it")
+)
+
+type goldenOptions struct {
+	hostname bool
+	times    bool
+	order    bool
+	alert    []func(*Alert)
+	text     []func(string) string
+}
+
+// GoldenOption is an option for golden snapshots
+type GoldenOption func(*goldenOptions)
+
+// NormalizeHostname replaces the hostname reported in alerts with a
+// placeholder, both in the hostname field of alerts and in the "hostname"
+// values of JSON text output. Other occurrences are left untouched.
+func NormalizeHostname() GoldenOption {
+	return func(o *goldenOptions) { o.hostname = true }
+}
+
+// NormalizeTimes replaces wall-clock times with a placeholder, both in the
+// time and output fields of alerts and in text output. Times in the
+// ISO 8601 format and in the default Falco time format are recognized,
+// as well as the numeric values of the "evt.time" fields in JSON text.
+func NormalizeTimes() GoldenOption {
+	return func(o *goldenOptions) { o.times = true }
+}
+
+// NormalizeOrder sorts alerts by time, rule, and output, alert tags by name,
+// and text output lines alphabetically, so that snapshots don't depend on
+// the order in which Falco produces its output.
+func NormalizeOrder() GoldenOption {
+	return func(o *goldenOptions) { o.order = true }
+}
+
+// NormalizeAlerts normalizes each alert with the given function before
+// the detections are compared with their golden file.
+func NormalizeAlerts(f func(*Alert)) GoldenOption {
+	return func(o *goldenOptions) { o.alert = append(o.alert, f) }
+}
+
+// NormalizeText normalizes text output with the given function before
+// it is compared with its golden file.
+func NormalizeText(f func(string) string) GoldenOption {
+	return func(o *goldenOptions) { o.text = append(o.text, f) }
+}
+
+// ExpectDetectionsGolden compares the detections of the Falco run with the
+// golden file of the running test, and reports a test error with their
+// difference if they don't match. Alerts are stored one per line in a
+// canonical JSON format, after applying the given normalizations. If
+// UpdateGolden is true, the golden file is written instead. Returns true
+// if the detections match the golden file.
+func (t *TestOutput) ExpectDetectionsGolden(tb testing.TB, options ...GoldenOption) bool {
+	tb.Helper()
+	opts := newGoldenOptions(options...)
+	detections, err := t.goldenDetections()
+	if err != nil {
+		tb.Errorf("can't read stdout line by line: %s", err.Error())
+		return false
+	}
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	for _, a := range opts.normalizeDetections(detections) {
+		if err := encoder.Encode(a); err != nil {
+			tb.Errorf("can't marshal alert: %s", err.Error())
+			return false
+		}
+	}
+	return ExpectGolden(tb, "detections", sb.String())
+}
+
+// ExpectStdoutGolden compares the text stdout of the Falco run with the
+// golden file of the running test, and reports a test error with their
+// difference if they don't match. The text is compared after applying the
+// given normalizations. If UpdateGolden is true, the golden file is
+// written instead. Returns true if the stdout matches the golden file.
+func (t *TestOutput) ExpectStdoutGolden(tb testing.TB, options ...GoldenOption) bool {
+	tb.Helper()
+	opts := newGoldenOptions(options...)
+	return ExpectGolden(tb, "stdout", opts.normalizeText(t.Stdout()))
+}
+
+// ExpectAlertLinesGolden compares the alerts printed by the Falco run in
+// JSON format with the golden file of the running test, and reports a test
+// error with their difference if they don't match. Unlike
+// ExpectDetectionsGolden, the lines of stdout are compared as Falco printed
+// them, so that unknown keys, key order and value formats are checked too.
+// Only the text normalizations are applied. If UpdateGolden is true, the
+// golden file is written instead. Returns true if the alerts match the
+// golden file.
+func (t *TestOutput) ExpectAlertLinesGolden(tb testing.TB, options ...GoldenOption) bool {
+	tb.Helper()
+	opts := newGoldenOptions(options...)
+	lines, err := readLineByLine(strings.NewReader(t.Stdout()))
+	if err != nil {
+		tb.Errorf("can't read stdout line by line: %s", err.Error())
+		return false
+	}
+	var sb strings.Builder
+	for _, line := range lines {
+		if err := json.Unmarshal([]byte(line), &Alert{}); err == nil {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+	return ExpectGolden(tb, "alerts", opts.normalizeText(sb.String()))
+}
+
+// goldenDetections parses the alerts in JSON format from stdout, by keeping
+// numbers as they are to avoid losing precision in snapshots.
+func (t *TestOutput) goldenDetections() (Detections, error) {
+	lines, err := readLineByLine(strings.NewReader(t.Stdout()))
+	if err != nil {
+		return nil, err
+	}
+	var res Detections
+	for _, line := range lines {
+		alert := &Alert{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(alert); err == nil {
+			res = append(res, alert)
+		}
+	}
+	return res, nil
+}
+
+// ExpectGolden compares the given content with the golden file of the
+// running test with the given kind, and reports a test error with their
+// difference if they don't match. Golden files are named after the test
+// and the kind, such as "TestName.kind.golden". If UpdateGolden is true,
+// the golden file is written instead. Returns true if the content
+// matches the golden file.
+func ExpectGolden(tb testing.TB, kind, content string) bool {
+	tb.Helper()
+	name := goldenNameRegex.ReplaceAllString(tb.Name(), "_") + "." + kind + ".golden"
+	path := filepath.Join(GoldenDir, name)
+	if UpdateGolden {
+		if err := os.MkdirAll(GoldenDir, os.ModePerm); err != nil {
+			tb.Errorf("can't create golden dir: %s", err.Error())
+			return false
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			tb.Errorf("can't write golden file: %s", err.Error())
+			return false
+		}
+		tb.Logf("updated golden file %s", path)
+		return true
+	}
+	expected, err := readGolden(name, path)
+	if err != nil {
+		tb.Errorf("can't read golden file %s: %s", path, err.Error())
+		return false
+	}
+	return assert.Equal(tb, string(expected), content, "golden file %s mismatch, run with -update to regenerate it", path)
+}
+
+func readGolden(name, path string) ([]byte, error) {
+	var res []byte
+	var err error
+	if GoldenFS != nil {
+		res, err = fs.ReadFile(GoldenFS, name)
+	} else {
+		res, err = os.ReadFile(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errGoldenNotFound
+	}
+	return res, err
+}
+
+func newGoldenOptions(options ...GoldenOption) *goldenOptions {
+	opts := &goldenOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
+func (o *goldenOptions) normalizeDetections(d Detections) Detections {
+	res := make(Detections, 0, len(d))
+	for _, a := range d {
+		alert := *a
+		alert.Tags = append([]string{}, a.Tags...)
+		alert.OutputFields = make(map[string]interface{})
+		for k, v := range a.OutputFields {
+			alert.OutputFields[k] = v
+		}
+		if o.hostname {
+			alert.Hostname = GoldenHostname
+		}
+		if o.times {
+			alert.Time = time.Time{}
+			alert.Output = goldenTimeRegex.ReplaceAllString(alert.Output, GoldenTime)
+			for k := range alert.OutputFields {
+				for _, prefix := range goldenTimeFields {
+					if strings.HasPrefix(k, prefix) {
+						alert.OutputFields[k] = GoldenTime
+					}
+				}
+			}
+		}
+		if o.order {
+			sort.Strings(alert.Tags)
+		}
+		for _, f := range o.alert {
+			f(&alert)
+		}
+		res = append(res, &alert)
+	}
+	if o.order {
+		sort.SliceStable(res, func(i, j int) bool {
+			if !res[i].Time.Equal(res[j].Time) {
+				return res[i].Time.Before(res[j].Time)
+			}
+			if res[i].Rule != res[j].Rule {
+				return res[i].Rule < res[j].Rule
+			}
+			return res[i].Output < res[j].Output
+		})
+	}
+	return res
+}
+
+func (o *goldenOptions) normalizeText(text string) string {
+	if o.hostname {
+		text = goldenHostRegex.ReplaceAllString(text, `${1}"`+GoldenHostname+`"`)
+	}
+	if o.times {
+		text = goldenTimeRegex.ReplaceAllString(text, GoldenTime)
+		text = goldenRawTimeRegex.ReplaceAllString(text, `${1}"`+GoldenTime+`"`)
+	}
+	if o.order {
+		lines, _ := readLineByLine(strings.NewReader(text))
+		sort.Strings(lines)
+		text = strings.Join(lines, "\n") + "\n"
+	}
+	for _, f := range o.text {
+		text = f(text)
+	}
+	return text
+}
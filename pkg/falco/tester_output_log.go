@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/testing/pkg/run"
+	"github.com/sirupsen/logrus"
+)
+
+// LogEntry is a log line printed by Falco.
+type LogEntry struct {
+	// Time is the timestamp of the line, or the zero time if the line
+	// has none (such as the error printed by Falco right before exiting)
+	Time time.Time
+	//
+	// Level is the severity of the line, or PriorityUnknown if the line
+	// doesn't report one
+	Level Priority
+	//
+	// Component is the Falco component that printed the line, such as
+	// "libs", or the empty string if the line doesn't report one
+	Component string
+	Message   string
+	Line      string
+}
+
+// LogEntries represents a list of log entries.
+type LogEntries []*LogEntry
+
+const (
+	logTimeLayout    = "Mon Jan _2 15:04:05 2006"
+	logISOTimeLayout = "2006-01-02T15:04:05Z0700"
+)
+
+var (
+	logTimeRegex      = regexp.MustCompile(`^(\w{3} \w{3} [ \d]\d \d{2}:\d{2}:\d{2} \d{4}|\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?): ?`)
+	logComponentRegex = regexp.MustCompile(`^\[([^\]]+)\]:? ?`)
+	logLevelRegex     = regexp.MustCompile(`^(?i)(debug|info|informational|notice|warn|warning|err|error|crit|critical|alert|emerg|emergency):`)
+)
+
+type jsonLogLine struct {
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+	Time  string `json:"time"`
+}
+
+// ParseLogLine parses a Falco log line, either in text format or in JSON
+// format (which Falco uses for its logs when json_output is enabled).
+// Text lines carry a timestamp, an optional component within square
+// brackets, and the message, which may start with the level (e.g. "Error: ").
+// Returns an error if the line is empty.
+func ParseLogLine(line string) (*LogEntry, error) {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("empty log line")
+	}
+	res := &LogEntry{Line: line}
+	msg := trimmed
+	if strings.HasPrefix(trimmed, "{") {
+		var j jsonLogLine
+		if err := json.Unmarshal([]byte(trimmed), &j); err == nil && len(j.Msg) > 0 {
+			res.Level, _ = ParsePriority(j.Level)
+			res.Time = parseLogTime(j.Time)
+			msg = strings.TrimSpace(j.Msg)
+		}
+	} else if m := logTimeRegex.FindStringSubmatch(msg); m != nil {
+		res.Time = parseLogTime(m[1])
+		msg = msg[len(m[0]):]
+	}
+	if m := logComponentRegex.FindStringSubmatch(msg); m != nil {
+		res.Component = m[1]
+		msg = msg[len(m[0]):]
+	}
+	if res.Level == PriorityUnknown {
+		if m := logLevelRegex.FindStringSubmatch(msg); m != nil {
+			res.Level, _ = ParsePriority(m[1])
+		}
+	}
+	res.Message = msg
+	return res, nil
+}
+
+func parseLogTime(s string) time.Time {
+	for _, layout := range []string{logTimeLayout, logISOTimeLayout, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Logs returns the log lines printed by Falco on stderr during the run,
+// in order of arrival.
+func (t *TestOutput) Logs() LogEntries {
+	var res LogEntries
+	for _, entry := range t.journal.Entries().OfStream(run.StreamStderr) {
+		if l, err := ParseLogLine(entry.Line); err == nil {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+func (l LogEntries) filter(f func(*LogEntry) bool) LogEntries {
+	var res LogEntries
+	for _, entry := range l {
+		if f(entry) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// OfLevel returns the list of entries with the given level.
+// The level can either be a Priority or its name. If the level can't be
+// parsed, an error is logged and no entry is returned.
+func (l LogEntries) OfLevel(v interface{}) LogEntries {
+	level, err := toPriority(v)
+	if err != nil {
+		logrus.WithError(err).Error("LogEntries.OfLevel: invalid level")
+		return nil
+	}
+	return l.filter(func(e *LogEntry) bool {
+		return e.Level == level
+	})
+}
+
+// AtLeast returns the list of entries with a level equal to or more severe
+// than the given one. Entries with an unknown level are excluded.
+func (l LogEntries) AtLeast(level Priority) LogEntries {
+	return l.filter(func(e *LogEntry) bool {
+		return e.Level != PriorityUnknown && e.Level >= level
+	})
+}
+
+// OfComponent returns the list of entries printed by the given component.
+func (l LogEntries) OfComponent(component string) LogEntries {
+	return l.filter(func(e *LogEntry) bool {
+		return e.Component == component
+	})
+}
+
+// Matching returns the list of entries of which message matches the given
+// value. The value can either be a string, matched as a substring, or a
+// *regexp.Regexp.
+func (l LogEntries) Matching(v interface{}) LogEntries {
+	return l.filter(func(e *LogEntry) bool {
+		return logMessageMatches(v, e.Message)
+	})
+}
+
+// Warnings returns the list of entries with the warning level.
+func (l LogEntries) Warnings() LogEntries {
+	return l.OfLevel(PriorityWarning)
+}
+
+// Errors returns the list of entries with the error level or a more
+// severe one.
+func (l LogEntries) Errors() LogEntries {
+	return l.AtLeast(PriorityError)
+}
+
+// Count returns the amount of entries in the list.
+func (l LogEntries) Count() int {
+	return len(l)
+}
+
+// String returns the lines of all entries joined by newlines.
+func (l LogEntries) String() string {
+	var sb strings.Builder
+	for _, entry := range l {
+		sb.WriteString(entry.Line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func logMessageMatches(v interface{}, msg string) bool {
+	if rgx, ok := v.(*regexp.Regexp); ok {
+		return rgx.MatchString(msg)
+	}
+	if str, ok := v.(string); ok {
+		return strings.Contains(msg, str)
+	}
+	panic("argument must be string or *regexp.Regexp")
+}
+
+// ExpectNoErrorLogs reports a test error listing all the log lines printed
+// by Falco with the error level or a more severe one, except the ones
+// matching any of the allowed values. Each value can either be a string,
+// matched as a substring, or a *regexp.Regexp. Returns true if there were
+// no unexpected errors.
+func (t *TestOutput) ExpectNoErrorLogs(tb testing.TB, allowed ...interface{}) bool {
+	tb.Helper()
+	unexpected := t.Logs().Errors().filter(func(e *LogEntry) bool {
+		for _, v := range allowed {
+			if logMessageMatches(v, e.Message) {
+				return false
+			}
+		}
+		return true
+	})
+	if unexpected.Count() > 0 {
+		tb.Errorf("unexpected error logs:\n%s", unexpected.String())
+		return false
+	}
+	return true
+}
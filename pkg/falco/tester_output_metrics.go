@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InternalMetricsRule is the rule of the alerts with which Falco emits
+// its internal metrics snapshots when metrics.output_rule is enabled.
+const InternalMetricsRule = "Falco internal: metrics snapshot"
+
+// Names of some of the fields of the Falco internal metrics snapshots.
+const (
+	InternalMetricEvents      = "scap.n_evts"
+	InternalMetricDrops       = "scap.n_drops"
+	InternalMetricMemoryRSS   = "falco.memory_rss"
+	InternalMetricRuleMatches = "falco.rules.matches_total"
+	//
+	// internalMetricRulePrefix is the prefix of the per-rule match counters
+	internalMetricRulePrefix = "falco.rules."
+)
+
+// InternalMetrics is a snapshot of the Falco internal metrics.
+type InternalMetrics struct {
+	Time time.Time
+	//
+	// Values contains all the numeric fields of the snapshot
+	Values map[string]float64
+	//
+	// Labels contains all the non-numeric fields of the snapshot,
+	// such as "falco.version"
+	Labels map[string]string
+}
+
+// InternalMetricsSeries represents a list of internal metrics snapshots,
+// in order of time.
+type InternalMetricsSeries []*InternalMetrics
+
+// WithInternalMetrics runs Falco by emitting its internal metrics snapshots
+// with the given interval as alerts (see TestOutput.InternalMetrics), which
+// are collected only if the output is in JSON format (see WithOutputJSON).
+func WithInternalMetrics(interval time.Duration) TestOption {
+	return func(o *testOptions) {
+		o.setConfig("metrics.enabled", "true")
+		o.setConfig("metrics.interval", formatMetricsInterval(interval))
+		o.setConfig("metrics.output_rule", "true")
+	}
+}
+
+// WithInternalMetricsFile runs Falco with its internal metrics enabled,
+// and by writing its snapshots to a file in the working directory of the
+// runner, which is collected once Falco terminates (see
+// TestOutput.InternalMetrics). The interval of the snapshots is the one of
+// the Falco config, unless set with WithInternalMetrics. This requires the
+// runner to support collecting files (see run.CollectsFiles).
+func WithInternalMetricsFile() TestOption {
+	return func(o *testOptions) {
+		o.setConfig("metrics.enabled", "true")
+		o.metricsOutputFile = true
+	}
+}
+
+// InternalMetrics returns the internal metrics snapshots emitted by Falco
+// during the run, in order of time. Since Falco writes the same snapshots
+// both as alerts and in the metrics output file, they are taken from the
+// file if Falco was run with WithInternalMetricsFile, and from the alerts
+// otherwise.
+func (t *TestOutput) InternalMetrics() InternalMetricsSeries {
+	var res InternalMetricsSeries
+	if t.opts.metricsOutputFile {
+		series, err := ParseInternalMetricsFile(t.metricsFile)
+		if err != nil {
+			logrus.WithError(err).Errorf("TestOutput.InternalMetrics: can't parse metrics output file")
+		}
+		res = series
+	} else {
+		for _, a := range t.Detections().OfRule(InternalMetricsRule) {
+			if m, err := ParseInternalMetrics(a); err == nil {
+				res = append(res, m)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Time.Before(res[j].Time)
+	})
+	return res
+}
+
+func formatMetricsInterval(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// ParseInternalMetrics parses an internal metrics snapshot from an alert.
+// Returns an error if the alert isn't a metrics snapshot.
+func ParseInternalMetrics(a *Alert) (*InternalMetrics, error) {
+	if a.Rule != InternalMetricsRule {
+		return nil, fmt.Errorf("alert is not a metrics snapshot: %s", a.Rule)
+	}
+	res := newInternalMetrics(a.OutputFields)
+	if !a.Time.IsZero() {
+		res.Time = a.Time
+	}
+	return res, nil
+}
+
+// ParseInternalMetricsFile parses the internal metrics snapshots written
+// by Falco to metrics.output_file, one JSON object per line. Each line is
+// either a whole metrics snapshot alert or just its output fields.
+func ParseInternalMetricsFile(content string) (InternalMetricsSeries, error) {
+	lines, err := readLineByLine(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	var res InternalMetricsSeries
+	for _, line := range lines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			return res, fmt.Errorf("invalid metrics snapshot: %w", err)
+		}
+		if fields, ok := obj["output_fields"].(map[string]interface{}); ok {
+			a := &Alert{Rule: InternalMetricsRule, OutputFields: fields}
+			if s, ok := obj["time"].(string); ok {
+				a.Time, _ = time.Parse(time.RFC3339Nano, s)
+			}
+			m, _ := ParseInternalMetrics(a)
+			res = append(res, m)
+			continue
+		}
+		res = append(res, newInternalMetrics(obj))
+	}
+	return res, nil
+}
+
+func newInternalMetrics(fields map[string]interface{}) *InternalMetrics {
+	res := &InternalMetrics{
+		Values: make(map[string]float64),
+		Labels: make(map[string]string),
+	}
+	for k, v := range fields {
+		if n, ok := toFloat64(v); ok {
+			res.Values[k] = n
+		} else if v != nil {
+			res.Labels[k] = fmt.Sprint(v)
+		}
+	}
+	// the event time is in nanoseconds since epoch
+	if ts, ok := res.Values["evt.time"]; ok {
+		res.Time = time.Unix(0, int64(ts))
+	}
+	return res
+}
+
+// Value returns the value of the numeric field with the given name.
+func (m *InternalMetrics) Value(name string) (float64, bool) {
+	v, ok := m.Values[name]
+	return v, ok
+}
+
+// Events returns the amount of events processed by Falco.
+func (m *InternalMetrics) Events() float64 {
+	return m.Values[InternalMetricEvents]
+}
+
+// Drops returns the amount of events dropped by Falco.
+func (m *InternalMetrics) Drops() float64 {
+	return m.Values[InternalMetricDrops]
+}
+
+// MemoryRSS returns the resident memory used by Falco.
+func (m *InternalMetrics) MemoryRSS() float64 {
+	return m.Values[InternalMetricMemoryRSS]
+}
+
+// RuleMatches returns the amount of matches of the given rule, or of all
+// rules if the name is empty.
+func (m *InternalMetrics) RuleMatches(rule string) float64 {
+	if len(rule) > 0 {
+		return m.Values[internalMetricRulePrefix+rule]
+	}
+	if v, ok := m.Values[InternalMetricRuleMatches]; ok {
+		return v
+	}
+	var res float64
+	for k, v := range m.Values {
+		if strings.HasPrefix(k, internalMetricRulePrefix) {
+			res += v
+		}
+	}
+	return res
+}
+
+// Count returns the amount of snapshots in the series.
+func (s InternalMetricsSeries) Count() int {
+	return len(s)
+}
+
+// Last returns the most recent snapshot of the series, or nil if the
+// series is empty.
+func (s InternalMetricsSeries) Last() *InternalMetrics {
+	if len(s) == 0 {
+		return nil
+	}
+	return s[len(s)-1]
+}
+
+// Values returns the values of the numeric field with the given name
+// across all the snapshots having it, in order of time.
+func (s InternalMetricsSeries) Values(name string) []float64 {
+	var res []float64
+	for _, m := range s {
+		if v, ok := m.Values[name]; ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Monotonic returns true if the values of the numeric field with the given
+// name never decrease across the series, such as for counters.
+func (s InternalMetricsSeries) Monotonic(name string) bool {
+	values := s.Values(name)
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Rate returns the average per-second increase of the numeric field with
+// the given name between the first and the last snapshots having it.
+// Returns zero if less than two snapshots have it, or if no time passed.
+func (s InternalMetricsSeries) Rate(name string) float64 {
+	var first, last *InternalMetrics
+	for _, m := range s {
+		if _, ok := m.Values[name]; ok {
+			if first == nil {
+				first = m
+			}
+			last = m
+		}
+	}
+	if first == nil || first == last {
+		return 0
+	}
+	elapsed := last.Time.Sub(first.Time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (last.Values[name] - first.Values[name]) / elapsed
+}
@@ -69,7 +69,7 @@ type RuleValidation struct {
 // validation results of Falco rules files. Returns nil if Falco wasn't run
 // for rules files validation.
 func (t *TestOutput) RuleValidation() *RuleValidation {
-	if !t.hasOutputJSON() {
+	if !t.OutputJSON() {
 		logrus.Errorf("TestOutput.Detections: must use WithOutputJSON")
 	}
 
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultWebserverPort is the port on which the Falco webserver listens
+	// if no other is configured
+	defaultWebserverPort = 8765
+	//
+	// defaultWebserverAddress is the address on which the Falco webserver
+	// listens if no other is configured
+	defaultWebserverAddress = "0.0.0.0"
+	//
+	// defaultGRPCAddress is the address on which the Falco gRPC server
+	// listens if no other is configured
+	defaultGRPCAddress = "0.0.0.0:5060"
+)
+
+// freePort returns a TCP port that is currently free on the given host
+// address. The port may be taken by someone else before being used,
+// but this is unlikely enough for a test harness.
+func freePort(host string) (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// hasConfigOverride returns true if the given config key is overridden
+// with the `-o` option.
+func (o *testOptions) hasConfigOverride(key string) bool {
+	for _, c := range o.configOverrides {
+		if c.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// configEnabled returns true if the given boolean config key is set to true.
+func (t *TestOutput) configEnabled(key string) bool {
+	v, ok := t.ConfigValue(key)
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// allocatePorts makes the Falco webserver and gRPC server, when enabled,
+// listen on addresses dedicated to the run, so that runs don't collide
+// with each other or with anything else on the host. Addresses set with
+// the `-o` option are left untouched. This must be used only with runners
+// sharing the network of the host.
+func (t *TestOutput) allocatePorts(workDir string) error {
+	if t.configEnabled("webserver.enabled") && !t.opts.hasConfigOverride("webserver.listen_port") {
+		port, err := freePort(t.webserverListenAddress())
+		if err != nil {
+			return err
+		}
+		t.opts.setConfig("webserver.listen_port", strconv.Itoa(port))
+	}
+	if t.configEnabled("grpc.enabled") && !t.opts.hasConfigOverride("grpc.bind_address") {
+		address := t.GRPCAddress()
+		if strings.HasPrefix(address, "unix://") {
+			// unix sockets are dedicated to the run by placing them in its
+			// working directory, which only works if the filesystem is shared
+			address = "unix://" + filepath.Join(workDir, fmt.Sprintf("falco-grpc-%d.sock", time.Now().UnixNano()))
+		} else {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host, _, _ = net.SplitHostPort(defaultGRPCAddress)
+			}
+			port, err := freePort(host)
+			if err != nil {
+				return err
+			}
+			address = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		t.opts.setConfig("grpc.bind_address", address)
+	}
+	return nil
+}
+
+// webserverListenAddress returns the address on which the Falco webserver
+// listens, as resolved from the configuration of the run.
+func (t *TestOutput) webserverListenAddress() string {
+	// note: overrides are taken verbatim, since addresses like "::"
+	// are not plain YAML scalars
+	for i := len(t.opts.configOverrides) - 1; i >= 0; i-- {
+		if c := t.opts.configOverrides[i]; c.Key == "webserver.listen_address" && len(c.Value) > 0 {
+			return c.Value
+		}
+	}
+	if v, ok := t.ConfigValue("webserver.listen_address"); ok {
+		if s, ok := v.(string); ok && len(s) > 0 {
+			return s
+		}
+	}
+	return defaultWebserverAddress
+}
+
+// WebserverURL returns the base URL of the Falco webserver, as resolved
+// from the configuration of the run. Unless set with the `-o` option, the
+// webserver listens on a free port allocated for the run, if enabled and
+// if the runner shares the network of the host. When listening on all the
+// interfaces, the webserver is reached through the loopback one.
+func (t *TestOutput) WebserverURL() string {
+	port := defaultWebserverPort
+	if v, ok := t.ConfigValue("webserver.listen_port"); ok {
+		if p, err := strconv.Atoi(fmt.Sprint(v)); err == nil {
+			port = p
+		}
+	}
+	scheme := "http"
+	if t.configEnabled("webserver.ssl_enabled") {
+		scheme = "https"
+	}
+	host := t.webserverListenAddress()
+	switch host {
+	case "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// MetricsURL returns the URL of the Falco prometheus endpoint, as resolved
+// from the configuration of the run (see WebserverURL).
+func (t *TestOutput) MetricsURL() string {
+	return t.WebserverURL() + "/metrics"
+}
+
+// GRPCAddress returns the address on which the Falco gRPC server listens,
+// as resolved from the configuration of the run, either as an IP address
+// and port or as a unix socket URL (e.g. "unix:///path/to/falco.sock").
+// Unless set with the `-o` option, the server listens on a free port or
+// on a socket allocated for the run, if enabled.
+func (t *TestOutput) GRPCAddress() string {
+	if v, ok := t.ConfigValue("grpc.bind_address"); ok {
+		if s := fmt.Sprint(v); len(s) > 0 {
+			return s
+		}
+	}
+	return defaultGRPCAddress
+}
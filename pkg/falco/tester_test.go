@@ -0,0 +1,843 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package falco
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/falcosecurity/client-go/pkg/api/outputs"
+	"github.com/falcosecurity/client-go/pkg/api/schema"
+	"github.com/falcosecurity/client-go/pkg/api/version"
+	"github.com/falcosecurity/testing/pkg/run"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newFakeFalcoRunner returns a runner for a shell script emulating Falco.
+// The script runs in the runner's working directory and receives the
+// same arguments that Falco would receive.
+func newFakeFalcoRunner(t *testing.T, script string) run.Runner {
+	path := filepath.Join(t.TempDir(), "falco")
+	require.Nil(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	runner, err := run.NewExecutableRunner(path)
+	require.Nil(t, err)
+	return runner
+}
+
+func TestConfigIncludes(t *testing.T) {
+	main := run.NewStringFileAccessor("main.yaml", "config_files: [/etc/falco/config.d]\njson_output: false\nlog_level: info\n")
+	runner := newFakeFalcoRunner(t, `
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-c" ]; then main="$2"; fi
+	shift
+done
+cat "$main"
+echo "Falco initialized with configuration files:" >&2
+echo "   $main | schema validation: ok" >&2
+echo "   include.yaml | schema validation: ok" >&2
+echo "   config.d/a.yaml | schema validation: ok" >&2
+echo "   config.d/b.yaml | schema validation: ok" >&2
+`)
+	res := Test(runner,
+		WithConfig(main),
+		WithConfigIncludes(run.NewStringFileAccessor("include.yaml", "json_output: true\nlog_level: warning\n")),
+		WithConfigIncludeDir("config.d",
+			run.NewStringFileAccessor("b.yaml", "log_level: error\n"),
+			run.NewStringFileAccessor("a.yaml", "log_level: debug\npriority: notice\n"),
+		),
+	)
+	require.Nil(t, res.Err(), "%s", res.Stderr())
+
+	staged, err := NewConfigBuilder().WithYAML(res.Stdout()).Config()
+	require.Nil(t, err)
+	require.Equal(t, []string{"/etc/falco/config.d", "include.yaml", "config.d"}, staged.ConfigFiles)
+	require.False(t, *staged.JSONOutput)
+
+	loaded := res.LoadedConfigFiles()
+	require.Len(t, loaded, 4)
+	require.Equal(t, mainConfigWithIncludesName, loaded[0].Path)
+	require.Equal(t, "ok", loaded[0].SchemaValidation)
+	require.Equal(t, "config.d/b.yaml", loaded[3].Path)
+
+	merged, err := res.StagedConfig()
+	require.Nil(t, err)
+	require.True(t, *merged.JSONOutput)
+	require.Equal(t, "error", merged.LogLevel)
+	require.Equal(t, PriorityNotice, merged.Priority)
+
+	res = Test(runner, WithConfigIncludeDir("/etc/falco/config.d"))
+	require.Error(t, res.Err())
+}
+
+func TestOptionsModel(t *testing.T) {
+	runner := newFakeFalcoRunner(t, `echo "$@"`)
+
+	res := Test(runner, WithConfig(run.NewStringFileAccessor("falco.yaml", "json_output: true\nwebserver:\n  listen_port: 8765\n")))
+	require.Nil(t, res.Err())
+	require.True(t, res.OutputJSON())
+	port, ok := res.ConfigValue("webserver.listen_port")
+	require.True(t, ok)
+	require.Equal(t, 8765, port)
+	_, ok = res.ConfigValue("webserver.missing")
+	require.False(t, ok)
+
+	res = Test(runner,
+		WithConfig(run.NewStringFileAccessor("falco.yaml", "json_output: true\n")),
+		WithArgs("--option", "json_output=false", "-L"),
+		WithConfigOverride("webserver.listen_port", "1234"),
+	)
+	require.Nil(t, res.Err())
+	require.False(t, res.OutputJSON())
+	port, ok = res.ConfigValue("webserver.listen_port")
+	require.True(t, ok)
+	require.Equal(t, 1234, port)
+	require.Equal(t, "-c falco.yaml -L", strings.Join(res.CommandLine()[:3], " "))
+	require.Contains(t, res.CommandLine(), "json_output=false")
+	require.Equal(t, strings.Join(res.CommandLine(), " ")+"\n", res.Stdout())
+
+	res = Test(runner, WithArgs("-c", "other.yaml"), WithOutputJSON())
+	require.Equal(t, "other.yaml", res.CommandLine()[1])
+	require.True(t, res.OutputJSON())
+
+	// `-o` options are moved after all the other args, in their original order
+	res = Test(runner, WithArgs("-o", "a=1", "-r", "rules.yaml", "--option=b=2", "-A"))
+	require.Nil(t, res.Err())
+	require.Equal(t, "-r rules.yaml -A", strings.Join(res.CommandLine()[2:5], " "))
+	require.Contains(t, strings.Join(res.CommandLine()[5:], " "), "-o a=1 -o b=2")
+
+	// stdout output is enforced unless explicitly disabled
+	res = Test(runner)
+	require.Contains(t, res.CommandLine(), "stdout_output.enabled=true")
+	res = Test(runner, WithArgs("-o", "stdout_output.enabled=false"))
+	require.Contains(t, res.CommandLine(), "stdout_output.enabled=false")
+	require.NotContains(t, res.CommandLine(), "stdout_output.enabled=true")
+}
+
+func TestEngine(t *testing.T) {
+	runner := newFakeFalcoRunner(t, `echo "$@"`)
+	capture := run.NewStringFileAccessor("capture.scap", "")
+
+	res := Test(runner, WithEngine(&Engine{Kind: EngineModernEBPF, CPUsForEachBuffer: Ptr(2), BufSizePreset: Ptr(4)}))
+	require.Nil(t, res.Err())
+	require.Contains(t, res.CommandLine(), "engine.kind=modern_ebpf")
+	require.Contains(t, res.CommandLine(), "engine.modern_ebpf.cpus_for_each_buffer=2")
+	require.Contains(t, res.CommandLine(), "engine.modern_ebpf.buf_size_preset=4")
+
+	res = Test(runner, WithCaptureFile(capture))
+	require.Nil(t, res.Err())
+	require.Contains(t, res.CommandLine(), "engine.replay.capture_file=capture.scap")
+
+	invalid := map[string][]TestOption{
+		"unknown-kind":         {WithEngine(&Engine{Kind: "unknown"})},
+		"replay-no-capture":    {WithEngine(&Engine{Kind: EngineReplay})},
+		"gvisor-no-config":     {WithEngine(&Engine{Kind: EngineGVisor})},
+		"kmod-cpus":            {WithEngine(&Engine{Kind: EngineKmod, CPUsForEachBuffer: Ptr(2)})},
+		"nodriver-buf-size":    {WithEngine(&Engine{Kind: EngineNoDriver, BufSizePreset: Ptr(4)})},
+		"modern-probe":         {WithEngine(&Engine{Kind: EngineModernEBPF, Probe: "probe.o"})},
+		"buf-size-range":       {WithEngine(&Engine{Kind: EngineKmod, BufSizePreset: Ptr(11)})},
+		"capture-and-kmod":     {WithCaptureFile(capture), WithEngine(&Engine{Kind: EngineKmod})},
+		"conflicting-override": {WithEngine(&Engine{Kind: EngineKmod}), WithArgs("-o", "engine.kind=ebpf")},
+	}
+	for name, opts := range invalid {
+		t.Run(name, func(t *testing.T) {
+			res := Test(runner, opts...)
+			require.Error(t, res.Err())
+			require.Empty(t, res.Stdout())
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	res := Test(newFakeFalcoRunner(t, `exit 2`))
+	require.Equal(t, 2, res.ExitCode())
+	require.Equal(t, res.Result().ExitCode, res.ExitCode())
+
+	res = Test(newFakeFalcoRunner(t, `kill -TERM $$`))
+	require.Equal(t, -1, res.ExitCode())
+	require.Equal(t, res.Result().ExitCode, res.ExitCode())
+
+	res = Test(newFakeFalcoRunner(t, `exec sleep 5`), WithContextDeadline(100*time.Millisecond))
+	require.True(t, res.Result().TimedOut)
+	require.Equal(t, -1, res.ExitCode())
+	require.Equal(t, res.Result().ExitCode, res.ExitCode())
+}
+
+func TestAlertStream(t *testing.T) {
+	runner := newFakeFalcoRunner(t, `
+echo "Falco initialized" >&2
+echo '{"rule":"A","priority":"Warning","output":"a1"}'
+echo '{"rule":"B","priority":"Notice","output":"b1"}'
+echo 'not an alert'
+echo '{"rule":"A","priority":"Warning","output":"a2"}'
+exec sleep 10
+`)
+	var streamed []string
+	ch := make(chan *Alert, 10)
+	start := time.Now()
+	res := Test(runner,
+		WithOutputJSON(),
+		WithAlertCallback(func(a *Alert) { streamed = append(streamed, a.Output) }),
+		WithAlertChannel(ch),
+		WithStopAfterAlerts(2, "A"),
+	)
+	require.Nil(t, res.Err(), "%s", res.Stderr())
+	require.True(t, res.StopConditionMet())
+	require.False(t, res.DurationExceeded())
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, []string{"a1", "b1", "a2"}, streamed)
+	require.Equal(t, 2, res.Detections().OfRule("A").Count())
+
+	var received []string
+	for a := range ch {
+		received = append(received, a.Output)
+	}
+	require.Equal(t, streamed, received)
+
+	// Falco is stopped gracefully and can go through its shutdown sequence
+	res = Test(newFakeFalcoRunner(t, `
+trap 'echo "SIGTERM received, shutting down" >&2; exit 0' TERM
+echo '{"rule":"A","priority":"Warning","output":"a1"}'
+while true; do sleep 0.05; done
+`),
+		WithOutputJSON(),
+		WithStopAfterAlerts(1, "A"),
+	)
+	require.Nil(t, res.Err())
+	require.True(t, res.StopConditionMet())
+	require.Contains(t, res.Stderr(), "shutting down")
+
+	res = Test(newFakeFalcoRunner(t, `echo '{"rule":"A"}'`),
+		WithOutputJSON(),
+		WithStopAfterAlerts(2, "A"),
+	)
+	require.Nil(t, res.Err())
+	require.False(t, res.StopConditionMet())
+}
+
+func TestGolden(t *testing.T) {
+	dir := t.TempDir()
+	defer func(d string) { GoldenDir, UpdateGolden = d, false }(GoldenDir)
+	GoldenDir = dir
+
+	// a short hostname must only be replaced where it's reported as such
+	script := `
+echo '{"time":"2023-01-01T00:00:01.123456789Z","rule":"B","priority":"Notice","hostname":"o","tags":["z","a"],"output":"2023-01-01T00:00:01.123456789+0000: Notice on o","output_fields":{"evt.time":1672531201123456789,"proc.name":"ls"},"extra":1}'
+echo '{"time":"2023-01-01T00:00:00.123456789Z","rule":"A","priority":"Warning","hostname":"o","tags":[],"output":"00:00:00.123456789: Warning","output_fields":{"evt.time":1672531200123456789}}'
+echo "text on o"
+`
+	res := Test(newFakeFalcoRunner(t, script), WithOutputJSON())
+	options := []GoldenOption{NormalizeHostname(), NormalizeTimes(), NormalizeOrder()}
+
+	UpdateGolden = true
+	require.True(t, res.ExpectDetectionsGolden(t, options...))
+	require.True(t, res.ExpectStdoutGolden(t, options...))
+	require.True(t, res.ExpectAlertLinesGolden(t, NormalizeHostname(), NormalizeTimes()))
+	content, err := os.ReadFile(filepath.Join(dir, "TestGolden.detections.golden"))
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	require.JSONEq(t, `{"time":"0001-01-01T00:00:00Z","rule":"A","priority":"Warning","source":"","hostname":"<hostname>","tags":[],"output":"<time>: Warning","output_fields":{"evt.time":"<time>"}}`, lines[0])
+	require.Contains(t, lines[1], `"tags":["a","z"]`)
+	require.Contains(t, lines[1], `"output":"<time>: Notice on o"`)
+	content, err = os.ReadFile(filepath.Join(dir, "TestGolden.stdout.golden"))
+	require.Nil(t, err)
+	require.Contains(t, string(content), "text on o\n")
+	require.Contains(t, string(content), `"hostname":"<hostname>","tags":["z","a"],"output":"<time>: Notice on o"`)
+	content, err = os.ReadFile(filepath.Join(dir, "TestGolden.alerts.golden"))
+	require.Nil(t, err)
+	require.Equal(t, `{"time":"<time>","rule":"B","priority":"Notice","hostname":"<hostname>","tags":["z","a"],"output":"<time>: Notice on o","output_fields":{"evt.time":"<time>","proc.name":"ls"},"extra":1}
+{"time":"<time>","rule":"A","priority":"Warning","hostname":"<hostname>","tags":[],"output":"<time>: Warning","output_fields":{"evt.time":"<time>"}}
+`, string(content))
+
+	// numbers must not lose precision without normalization
+	UpdateGolden = true
+	require.True(t, ExpectGolden(t, "raw", "x"))
+	require.True(t, res.ExpectDetectionsGolden(t))
+	content, err = os.ReadFile(filepath.Join(dir, "TestGolden.detections.golden"))
+	require.Nil(t, err)
+	require.Contains(t, string(content), `"evt.time":1672531201123456789`)
+
+	UpdateGolden = false
+	require.True(t, res.ExpectDetectionsGolden(t))
+	tb := &recordingTB{TB: t}
+	require.False(t, res.ExpectDetectionsGolden(tb, NormalizeHostname()))
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], "mismatch")
+	require.False(t, ExpectGolden(tb, "missing", ""))
+	require.Contains(t, tb.errors[1], "run with -update")
+}
+
+type fakeGRPCOutputServer struct {
+	outputs.UnimplementedServiceServer
+}
+
+type fakeGRPCVersionServer struct {
+	version.UnimplementedServiceServer
+}
+
+func (s *fakeGRPCOutputServer) Sub(srv outputs.Service_SubServer) error {
+	if _, err := srv.Recv(); err != nil {
+		return err
+	}
+	for _, rule := range []string{"A", "B"} {
+		err := srv.Send(&outputs.Response{
+			Time:         timestamppb.Now(),
+			Priority:     schema.Priority_WARNING,
+			Rule:         rule,
+			Output:       "output " + rule,
+			OutputFields: map[string]string{"proc.name": "cat"},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	<-srv.Context().Done()
+	return nil
+}
+
+func (s *fakeGRPCVersionServer) Version(context.Context, *version.Request) (*version.Response, error) {
+	return &version.Response{Version: "0.1.2", Major: 0, Minor: 1, Patch: 2}, nil
+}
+
+func TestGRPCOutput(t *testing.T) {
+	// the fake Falco tells the test where to listen, and the test
+	// serves the gRPC services in its place
+	sockFile := filepath.Join(t.TempDir(), "socket.txt")
+	runner := newFakeFalcoRunner(t, `
+for arg; do
+	case "$arg" in
+		grpc.bind_address=unix://*) echo "${arg#grpc.bind_address=unix://}" > "$SOCKFILE" ;;
+	esac
+done
+exec sleep 1
+`)
+	go func() {
+		var path []byte
+		for len(path) == 0 {
+			time.Sleep(10 * time.Millisecond)
+			path, _ = os.ReadFile(sockFile)
+		}
+		l, err := net.Listen("unix", strings.TrimSpace(string(path)))
+		if err != nil {
+			return
+		}
+		srv := grpc.NewServer()
+		outputs.RegisterServiceServer(srv, &fakeGRPCOutputServer{})
+		version.RegisterServiceServer(srv, &fakeGRPCVersionServer{})
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			srv.Stop()
+		}()
+		_ = srv.Serve(l)
+	}()
+
+	res := Test(runner, WithGRPCOutput(), WithEnvVars(map[string]string{"SOCKFILE": sockFile}))
+	require.Nil(t, res.Err(), "%s", res.Stderr())
+	grpcRes := res.GRPCOutput()
+	require.NotNil(t, grpcRes)
+	require.Nil(t, grpcRes.Err)
+	require.NotNil(t, grpcRes.Version)
+	require.Equal(t, "0.1.2", grpcRes.Version.Version)
+	require.Equal(t, 2, grpcRes.Detections.Count())
+	require.Equal(t, 2, grpcRes.Detections.OfPriority(PriorityWarning).Count())
+	require.Equal(t, 1, grpcRes.Detections.OfRule("B").OfOutputField("proc.name", "cat").Count())
+	value, ok := res.ConfigValue("grpc_output.enabled")
+	require.True(t, ok)
+	require.Equal(t, true, value)
+
+	require.Nil(t, Test(newFakeFalcoRunner(t, "")).GRPCOutput())
+}
+
+func TestHTTPOutput(t *testing.T) {
+	r, err := NewHTTPReceiver(
+		WithHTTPResponder(func(n int, req *HTTPRequest) HTTPResponse {
+			if n == 0 {
+				return HTTPResponse{StatusCode: http.StatusServiceUnavailable}
+			}
+			return HTTPResponse{StatusCode: http.StatusOK}
+		}),
+		WithHTTPResponseDelay(50*time.Millisecond),
+	)
+	require.Nil(t, err)
+	defer r.Close()
+	res, err := http.Post(r.URL(), "application/json", strings.NewReader(`{"rule":"A","priority":"Warning"}`))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	res, err = http.Post(r.URL()+"path", "text/plain", strings.NewReader("16:17:57.881781397: Notice text alert\n"))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	requests := r.Requests()
+	require.Len(t, requests, 2)
+	require.Equal(t, "application/json", requests[0].ContentType)
+	require.Equal(t, "/path", requests[1].Path)
+	require.Equal(t, 50*time.Millisecond, requests[1].Delay)
+	require.Equal(t, 2, r.Detections().Count())
+	require.Equal(t, 1, r.Detections().OfPriority(PriorityNotice).Count())
+
+	// responders may inspect the receiver, and default to 200
+	var r2 *HTTPReceiver
+	r2, err = NewHTTPReceiver(WithHTTPResponder(func(n int, req *HTTPRequest) HTTPResponse {
+		require.Len(t, r2.Requests(), n+1)
+		return HTTPResponse{Delay: 10 * time.Millisecond}
+	}))
+	require.Nil(t, err)
+	defer r2.Close()
+	res, err = http.Post(r2.URL(), "text/plain", strings.NewReader("16:17:57.881781397: Notice text alert\n"))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, http.StatusOK, r2.Requests()[0].StatusCode)
+
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not available")
+	}
+	// the fake Falco posts to the url it's configured with
+	out := Test(newFakeFalcoRunner(t, `
+for arg; do
+	case "$arg" in
+		http_output.url=*) url="${arg#http_output.url=}" ;;
+	esac
+done
+curl -s -o /dev/null -H "Content-Type: application/json" -d '{"rule":"A","priority":"Error"}' "$url"
+`), WithHTTPOutput(WithHTTPResponseCode(http.StatusCreated)))
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	require.NotNil(t, out.HTTPOutput())
+	require.Len(t, out.HTTPOutput().Requests(), 1)
+	require.Equal(t, http.StatusCreated, out.HTTPOutput().Requests()[0].StatusCode)
+	require.Equal(t, 1, out.HTTPOutput().Detections().OfRule("A").Count())
+	value, ok := out.ConfigValue("http_output.url")
+	require.True(t, ok)
+	require.Equal(t, out.HTTPOutput().URL(), value)
+}
+
+func TestSyslogOutput(t *testing.T) {
+	m, err := ParseSyslogMessage("<12>Oct  8 15:04:05 falco[42]: 16:17:57.881781397: Warning An open was seen")
+	require.Nil(t, err)
+	require.Equal(t, SyslogFormatRFC3164, m.Format)
+	require.Equal(t, 1, m.Facility)
+	require.Equal(t, 4, m.Severity)
+	require.Equal(t, PriorityWarning, m.Priority())
+	require.Equal(t, "falco", m.Tag)
+	require.Equal(t, "42", m.PID)
+	require.Empty(t, m.Hostname)
+	require.Equal(t, time.October, m.Time.Month())
+	require.Equal(t, "16:17:57.881781397: Warning An open was seen", m.Message)
+	require.Equal(t, PriorityWarning, m.Alert().Priority)
+
+	m, err = ParseSyslogMessage("<11>Oct 18 15:04:05 myhost falco: not an alert")
+	require.Nil(t, err)
+	require.Equal(t, "myhost", m.Hostname)
+	require.Equal(t, "falco", m.Tag)
+	require.Equal(t, PriorityError, m.Alert().Priority)
+	require.Equal(t, "not an alert", m.Alert().Output)
+
+	m, err = ParseSyslogMessage(`<165>1 2023-10-11T22:14:15.003Z myhost falco 42 ID47 [ex@32473 a="b\]c"][x@1 y="z"] {"rule":"A","priority":"Notice"}`)
+	require.Nil(t, err)
+	require.Equal(t, SyslogFormatRFC5424, m.Format)
+	require.Equal(t, 20, m.Facility)
+	require.Equal(t, 5, m.Severity)
+	require.Equal(t, "myhost", m.Hostname)
+	require.Equal(t, "falco", m.Tag)
+	require.Equal(t, "42", m.PID)
+	require.Equal(t, "ID47", m.MsgID)
+	require.Equal(t, 2023, m.Time.Year())
+	require.Equal(t, `{"rule":"A","priority":"Notice"}`, m.Message)
+	require.Equal(t, "A", m.Alert().Rule)
+
+	m, err = ParseSyslogMessage("<14>1 - - - - - - msg")
+	require.Nil(t, err)
+	require.True(t, m.Time.IsZero())
+	require.Equal(t, "msg", m.Message)
+
+	_, err = ParseSyslogMessage("no priority")
+	require.Error(t, err)
+
+	r, err := NewSyslogReceiver("udp", "")
+	require.Nil(t, err)
+	conn, err := net.Dial("udp", r.Address())
+	require.Nil(t, err)
+	_, err = conn.Write([]byte("<10>Oct 18 15:04:05 falco: 16:17:57.881781397: Critical alert"))
+	require.Nil(t, err)
+	_, err = conn.Write([]byte("garbage"))
+	require.Nil(t, err)
+	conn.Close()
+	require.Eventually(t, func() bool { return len(r.Messages()) == 1 && len(r.Errors()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Nil(t, r.Close())
+	require.Equal(t, 1, r.Detections().OfPriority(PriorityCritical).Count())
+
+	// falco only writes to a local socket
+	out := Test(newFakeFalcoRunner(t, `exit 0`), WithSyslogOutput("udp", ""))
+	require.Error(t, out.Err())
+	require.Nil(t, out.SyslogOutput())
+
+	if _, err := exec.LookPath("logger"); err != nil {
+		t.Skip("logger not available")
+	}
+	sock := filepath.Join(t.TempDir(), "log.sock")
+	out = Test(newFakeFalcoRunner(t, `logger -u "$SYSLOG_SOCKET" -t falco -p user.warning '{"rule":"A"}'`),
+		WithSyslogOutput("unixgram", sock),
+		WithEnvVars(map[string]string{"SYSLOG_SOCKET": sock}),
+	)
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	require.NotNil(t, out.SyslogOutput())
+	require.Len(t, out.SyslogOutput().Messages(), 1)
+	require.Equal(t, "falco", out.SyslogOutput().Messages()[0].Tag)
+	require.Equal(t, 1, out.SyslogOutput().Detections().OfRule("A").OfPriority(PriorityWarning).Count())
+	_, err = os.Stat(sock)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestOutputSinks(t *testing.T) {
+	file, err := NewFileOutputSink()
+	require.Nil(t, err)
+	require.Equal(t, "file_output", file.Name())
+	require.Empty(t, file.Detections())
+
+	// the fake Falco writes to the file_output and runs the program_output
+	runner := newFakeFalcoRunner(t, `
+for arg; do
+	case "$arg" in
+		file_output.filename=*) file="${arg#file_output.filename=}" ;;
+		program_output.program=*) program="${arg#program_output.program=}" ;;
+	esac
+done
+echo '{"rule":"A","priority":"Warning"}' >> "$file"
+echo '16:17:57.881781397: Error text alert' | sh -c "$program"
+echo '{"rule":"B","priority":"Notice"}' | sh -c "$program"
+`)
+	out := Test(runner, WithOutputSinks(file), WithProgramOutput())
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	require.Len(t, out.OutputSinks(), 2)
+	require.Equal(t, file, out.OutputSink("file_output"))
+	require.Nil(t, out.OutputSink("http_output"))
+
+	// the files are collected from the runner, and removed with its workdir
+	require.Equal(t, runner.WorkDir(), filepath.Dir(file.Path()))
+	_, err = os.Stat(file.Path())
+	require.True(t, os.IsNotExist(err))
+	content, err := file.Content()
+	require.Nil(t, err)
+	require.Equal(t, "{\"rule\":\"A\",\"priority\":\"Warning\"}\n", string(content))
+	require.Equal(t, 1, file.Detections().OfRule("A").Count())
+
+	program := out.OutputSink("program_output")
+	require.NotNil(t, program)
+	require.Equal(t, 2, program.Detections().Count())
+	require.Equal(t, 1, program.Detections().OfPriority(PriorityError).Count())
+	require.Equal(t, 1, program.Detections().OfRule("B").Count())
+	value, ok := out.ConfigValue("program_output.enabled")
+	require.True(t, ok)
+	require.Equal(t, true, value)
+	require.Nil(t, program.Close())
+
+	// runners that can't collect files can't be used with file sinks
+	out = Test(struct{ run.Runner }{newFakeFalcoRunner(t, `exit 0`)}, WithFileOutput())
+	require.Error(t, out.Err())
+}
+
+func TestOutputEvents(t *testing.T) {
+	e, err := ParseOutputEvent(`Sat Oct 18 15:04:05 2026: "outputs.write" output timeout, all output channels are blocked.`)
+	require.Nil(t, err)
+	require.Equal(t, OutputEventTimeout, e.Kind)
+	require.Equal(t, "outputs.write", e.Payload)
+	e, err = ParseOutputEvent("Sat Oct 18 15:04:05 2026: Outputs queue out of memory. Drop event and continue on ...")
+	require.Nil(t, err)
+	require.Equal(t, OutputEventQueueDrop, e.Kind)
+	_, err = ParseOutputEvent("Sat Oct 18 15:04:05 2026: Falco initialized")
+	require.Error(t, err)
+
+	// the fake Falco runs a slow and failing program_output and
+	// reports the resulting backpressure
+	out := Test(newFakeFalcoRunner(t, `
+for arg; do
+	case "$arg" in
+		program_output.program=*) program="${arg#program_output.program=}" ;;
+	esac
+done
+echo '{"rule":"A","priority":"Warning"}' | sh -c "$program"
+echo "Sat Oct 18 15:04:05 2026: Outputs queue out of memory. Drop event and continue on ..." >&2
+echo '"A" output timeout, all output channels are blocked.' >&2
+`), WithProgramOutput(WithProgramDelay(100*time.Millisecond), WithProgramExitCode(3)), WithOutputTimeout(50*time.Millisecond))
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	require.Contains(t, out.Stderr(), "program_output sink failure")
+	require.Equal(t, 1, out.OutputSink("program_output").Detections().OfRule("A").Count())
+	value, ok := out.ConfigValue("output_timeout")
+	require.True(t, ok)
+	require.Equal(t, 50, value)
+
+	events := out.OutputEvents()
+	require.Equal(t, 2, events.Count())
+	require.Equal(t, 1, events.Timeouts().Count())
+	require.Equal(t, "A", events.Timeouts()[0].Payload)
+	require.Equal(t, 1, events.QueueDrops().Count())
+	require.True(t, events[0].Time.Before(events[1].Time) || events[0].Time.Equal(events[1].Time))
+}
+
+func TestLogs(t *testing.T) {
+	l, err := ParseLogLine("Sat Oct 18 15:04:05 2026: [libs]: some libs message")
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2026, time.October, 18, 15, 4, 5, 0, time.UTC), l.Time)
+	require.Equal(t, "libs", l.Component)
+	require.Equal(t, "some libs message", l.Message)
+	require.Equal(t, PriorityUnknown, l.Level)
+	l, err = ParseLogLine(`{"level":"WARNING","msg":"deprecated config\n","time":"2026-10-18T15:04:05+0000"}`)
+	require.Nil(t, err)
+	require.Equal(t, PriorityWarning, l.Level)
+	require.Equal(t, "deprecated config", l.Message)
+	require.Equal(t, 2026, l.Time.Year())
+	l, err = ParseLogLine("Error: You must specify at least one rules file")
+	require.Nil(t, err)
+	require.True(t, l.Time.IsZero())
+	require.Equal(t, PriorityError, l.Level)
+	_, err = ParseLogLine("  ")
+	require.Error(t, err)
+
+	out := Test(newFakeFalcoRunner(t, `
+echo '{"level":"INFO","msg":"Falco initialized","time":"2026-10-18T15:04:05+0000"}' >&2
+echo '{"level":"WARNING","msg":"[libs]: driver is outdated","time":"2026-10-18T15:04:05+0000"}' >&2
+echo '{"level":"ERROR","msg":"Could not open file","time":"2026-10-18T15:04:06+0000"}' >&2
+echo '{"rule":"A","priority":"Critical"}'
+echo 'Error: something went wrong' >&2
+`))
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	logs := out.Logs()
+	require.Equal(t, 4, logs.Count())
+	require.Equal(t, 1, logs.Warnings().Count())
+	require.Equal(t, 1, logs.OfComponent("libs").Count())
+	require.Equal(t, 2, logs.Errors().Count())
+	require.Equal(t, 1, logs.OfLevel("info").Matching(regexp.MustCompile(`^Falco`)).Count())
+	tb := &recordingTB{TB: t}
+	require.False(t, out.ExpectNoErrorLogs(tb, "Could not open"))
+	require.Len(t, tb.errors, 1)
+	require.Contains(t, tb.errors[0], "something went wrong")
+	require.True(t, out.ExpectNoErrorLogs(tb, "Could not open", regexp.MustCompile(`went wrong$`)))
+	require.Len(t, tb.errors, 1)
+}
+
+func TestMetrics(t *testing.T) {
+	samples, err := ParsePrometheusMetrics(strings.NewReader(`
+# HELP falcosecurity_scap_n_evts_total Number of events
+# TYPE falcosecurity_scap_n_evts_total counter
+falcosecurity_scap_n_evts_total{raw_name="n_evts"} 42
+# TYPE falcosecurity_falco_rules_matches_total counter
+falcosecurity_falco_rules_matches_total{priority="4",rule_name="A",source="syscall"} 3 1700000000000
+falcosecurity_falco_rules_matches_total{priority="5",rule_name="B \"quoted\"",source="syscall"} 1
+falcosecurity_scap_n_drops_total 0
+`))
+	require.Nil(t, err)
+	require.Equal(t, 4, samples.Count())
+	require.Equal(t, float64(42), samples.EventsProcessed())
+	require.Equal(t, "counter", samples.OfName(MetricEventsProcessed)[0].Type)
+	require.Equal(t, "untyped", samples.OfName(MetricEventsDropped)[0].Type)
+	require.True(t, samples.Has(MetricEventsDropped))
+	require.Zero(t, samples.EventsDropped())
+	require.Equal(t, float64(4), samples.RuleMatches(""))
+	require.Equal(t, float64(3), samples.RuleMatches("A"))
+	require.Equal(t, float64(1), samples.RuleMatches(`B "quoted"`))
+	require.Equal(t, 2, samples.OfNameMatching(regexp.MustCompile(`_total$`)).WithLabel("source", "syscall").Count())
+	require.Equal(t, 1, samples.WithLabelMatching("rule_name", regexp.MustCompile(`^B`)).Count())
+	require.Len(t, samples.Names(), 3)
+	_, err = ParsePrometheusMetrics(strings.NewReader(`broken{label="x} 1`))
+	require.Error(t, err)
+
+	// a fake endpoint exposes an increasing counter
+	var m sync.Mutex
+	count := 0
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		count++
+		_, _ = w.Write([]byte(fmt.Sprintf("%s %d\n", MetricEventsProcessed, count)))
+	})}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	out := Test(newFakeFalcoRunner(t, `sleep 0.5`),
+		WithMetricsScraping(50*time.Millisecond),
+		WithConfigOverride("webserver.listen_port", strconv.Itoa(l.Addr().(*net.TCPAddr).Port)),
+	)
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	require.NotNil(t, out.Metrics())
+	require.Nil(t, out.Metrics().Err)
+	require.NotNil(t, out.Metrics().Final())
+	series := out.Metrics().Series(MetricEventsProcessed)
+	require.Greater(t, len(series), 1)
+	require.Equal(t, series[len(series)-1], out.Metrics().Final().Samples.EventsProcessed())
+	for i := 1; i < len(series); i++ {
+		require.Greater(t, series[i], series[i-1])
+	}
+
+	// the first scrape doesn't wait for the interval, and is retried
+	// until the webserver comes up
+	port := l.Addr().(*net.TCPAddr).Port
+	require.Nil(t, server.Close())
+	late := make(chan *http.Server, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		l, err := net.Listen("tcp", l.Addr().String())
+		if err != nil {
+			late <- nil
+			return
+		}
+		server := &http.Server{Handler: server.Handler}
+		late <- server
+		_ = server.Serve(l)
+	}()
+	out = Test(newFakeFalcoRunner(t, `sleep 0.6`),
+		WithMetricsScraping(time.Hour),
+		WithConfigOverride("webserver.listen_port", strconv.Itoa(port)),
+	)
+	lateServer := <-late
+	require.NotNil(t, lateServer)
+	require.Nil(t, lateServer.Close())
+	require.Nil(t, out.Metrics().Err)
+	require.Len(t, out.Metrics().Snapshots, 1)
+
+	// no snapshot is collected if the endpoint is unreachable
+	out = Test(newFakeFalcoRunner(t, `sleep 0.2`),
+		WithMetricsScraping(50*time.Millisecond),
+		WithConfigOverride("webserver.listen_port", strconv.Itoa(l.Addr().(*net.TCPAddr).Port)),
+	)
+	require.Nil(t, out.Metrics().Final())
+	require.Error(t, out.Metrics().Err)
+}
+
+func TestInternalMetrics(t *testing.T) {
+	_, err := ParseInternalMetrics(&Alert{Rule: "A"})
+	require.Error(t, err)
+
+	// the fake Falco emits the same snapshots both as alerts and in the
+	// output file, like Falco does
+	script := `
+for arg; do
+	case "$arg" in
+		metrics.output_file=*) file="${arg#metrics.output_file=}" ;;
+	esac
+done
+snapshot() {
+	echo "$1"
+	if [ -n "$file" ]; then echo "$1" >> "$file"; fi
+}
+snapshot '{"rule":"Falco internal: metrics snapshot","priority":"Informational","time":"2026-10-18T15:04:05.000000000Z","output_fields":{"scap.n_evts":100,"scap.n_drops":0,"falco.memory_rss":32.5,"falco.rules.A":2,"falco.version":"0.39.0"}}'
+echo '{"rule":"A","priority":"Warning"}'
+snapshot '{"rule":"Falco internal: metrics snapshot","priority":"Informational","time":"2026-10-18T15:04:07.000000000Z","output_fields":{"scap.n_evts":300,"scap.n_drops":4,"falco.memory_rss":31,"falco.rules.A":3,"falco.rules.B":1}}'
+snapshot '{"rule":"Falco internal: metrics snapshot","priority":"Informational","time":"2026-10-18T15:04:09.000000000Z","output_fields":{"scap.n_evts":500,"falco.rules.matches_total":6}}'
+`
+	out := Test(newFakeFalcoRunner(t, script), WithOutputJSON(), WithInternalMetrics(2*time.Second), WithInternalMetricsFile())
+	require.Nil(t, out.Err(), "%s", out.Stderr())
+	value, ok := out.ConfigValue("metrics.interval")
+	require.True(t, ok)
+	require.Equal(t, "2s", value)
+
+	series := out.InternalMetrics()
+	require.Equal(t, 3, series.Count())
+	require.Equal(t, "0.39.0", series[0].Labels["falco.version"])
+	require.Equal(t, float64(100), series[0].Events())
+	require.Equal(t, 32.5, series[0].MemoryRSS())
+	require.Equal(t, float64(2), series[0].RuleMatches(""))
+	require.Equal(t, float64(4), series[1].Drops())
+	require.Equal(t, float64(4), series[1].RuleMatches(""))
+	require.Equal(t, float64(1), series[1].RuleMatches("B"))
+	require.Equal(t, float64(6), series.Last().RuleMatches(""))
+	require.Equal(t, time.Date(2026, 10, 18, 15, 4, 9, 0, time.UTC), series.Last().Time.UTC())
+	require.Equal(t, []float64{100, 300, 500}, series.Values(InternalMetricEvents))
+	require.True(t, series.Monotonic(InternalMetricEvents))
+	require.False(t, series.Monotonic(InternalMetricMemoryRSS))
+	require.Equal(t, float64(100), series[:2].Rate(InternalMetricEvents))
+	require.Equal(t, float64(100), series.Rate(InternalMetricEvents))
+	require.Zero(t, series[:1].Rate(InternalMetricEvents))
+
+	// file lines can also hold just the output fields of a snapshot
+	series, err = ParseInternalMetricsFile(`{"evt.time":1792335850000000000,"scap.n_evts":500,"falco.rules.matches_total":6}` + "\n")
+	require.Nil(t, err)
+	require.Equal(t, time.Unix(0, 1792335850000000000), series[0].Time)
+	require.Equal(t, float64(6), series[0].RuleMatches(""))
+
+	// snapshots are taken from the alerts without the output file
+	out = Test(newFakeFalcoRunner(t, script), WithOutputJSON(), WithInternalMetrics(2*time.Second))
+	require.Equal(t, []float64{100, 300, 500}, out.InternalMetrics().Values(InternalMetricEvents))
+
+	// the output file enables metrics on its own
+	out = Test(newFakeFalcoRunner(t, script), WithInternalMetricsFile())
+	require.Contains(t, out.CommandLine(), "metrics.enabled=true")
+	require.Equal(t, 3, out.InternalMetrics().Count())
+}
+
+func TestPortAllocation(t *testing.T) {
+	runner := newFakeFalcoRunner(t, `true`)
+	res := Test(runner, WithPrometheusMetrics())
+	require.Nil(t, res.Err(), "%s", res.Stderr())
+	value, ok := res.ConfigValue("webserver.listen_port")
+	require.True(t, ok)
+	require.NotEqual(t, defaultWebserverPort, value)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d/metrics", value), res.MetricsURL())
+
+	// ports set explicitly are preserved
+	res = Test(runner, WithPrometheusMetrics(), WithConfigOverride("webserver.listen_port", "9876"))
+	require.Equal(t, "http://127.0.0.1:9876", res.WebserverURL())
+	require.NotContains(t, res.CommandLine(), "grpc.bind_address")
+
+	// no port is allocated for disabled servers
+	res = Test(runner, WithConfigOverride("webserver.enabled", "false"))
+	for _, c := range res.ConfigOverrides() {
+		require.NotEqual(t, "webserver.listen_port", c.Key)
+	}
+
+	res = Test(runner, WithConfigOverride("grpc.enabled", "true"))
+	host, port, err := net.SplitHostPort(res.GRPCAddress())
+	require.Nil(t, err)
+	require.Equal(t, "0.0.0.0", host)
+	require.NotEqual(t, "5060", port)
+
+	config := run.NewStringFileAccessor("grpc.yaml", "grpc:\n  enabled: true\n  bind_address: unix:///tmp/falco/falco.sock\n")
+	res = Test(runner, WithConfig(config))
+	require.True(t, strings.HasPrefix(res.GRPCAddress(), "unix://"+runner.WorkDir()+"/"), res.GRPCAddress())
+
+	// the webserver is reached on the address it listens on
+	res = Test(runner, WithPrometheusMetrics(), WithConfigOverride("webserver.listen_address", "localhost"))
+	value, _ = res.ConfigValue("webserver.listen_port")
+	require.Equal(t, fmt.Sprintf("http://localhost:%d", value), res.WebserverURL())
+	res = Test(runner, WithPrometheusMetrics(), WithConfigOverride("webserver.listen_address", "::"), WithConfigOverride("webserver.listen_port", "9876"))
+	require.Equal(t, "http://[::1]:9876", res.WebserverURL())
+
+	// no port is allocated if the runner doesn't share the host network
+	isolated := struct{ run.Runner }{runner}
+	require.False(t, run.SharesHostNetwork(isolated))
+	require.True(t, run.SharesHostNetwork(runner))
+	res = Test(isolated, WithPrometheusMetrics(), WithConfigOverride("grpc.enabled", "true"))
+	require.Nil(t, res.Err(), "%s", res.Stderr())
+	require.NotContains(t, strings.Join(res.CommandLine(), " "), "webserver.listen_port")
+	require.NotContains(t, strings.Join(res.CommandLine(), " "), "grpc.bind_address")
+	res = Test(isolated, WithMetricsScraping(time.Second))
+	require.Error(t, res.Err())
+}
@@ -21,6 +21,7 @@ package falcoctl
 import (
 	"bytes"
 	"context"
+	"io"
 	"time"
 
 	"github.com/falcosecurity/testing/pkg/run"
@@ -50,10 +51,11 @@ type testOptions struct {
 
 // TestOutput is the output of a falcoctl test run
 type TestOutput struct {
-	opts   *testOptions
-	err    error
-	stdout bytes.Buffer
-	stderr bytes.Buffer
+	opts    *testOptions
+	err     error
+	stdout  bytes.Buffer
+	stderr  bytes.Buffer
+	journal *run.Journal
 }
 
 // TestOption is an option for testing falcoctl
@@ -63,6 +65,7 @@ type TestOption func(*testOptions)
 // an output representing the outcome of the run.
 func Test(runner run.Runner, options ...TestOption) *TestOutput {
 	res := &TestOutput{
+		journal: run.NewJournal(),
 		opts: &testOptions{
 			workdir:  runner.WorkDir(),
 			duration: DefaultMaxDuration,
@@ -83,9 +86,10 @@ func Test(runner run.Runner, options ...TestOption) *TestOutput {
 	res.err = runner.Run(ctx,
 		run.WithArgs(res.opts.args...),
 		run.WithFiles(res.opts.files...),
-		run.WithStdout(&res.stdout),
-		run.WithStderr(&res.stderr),
+		run.WithStdout(io.MultiWriter(&res.stdout, res.journal.Writer(run.StreamStdout))),
+		run.WithStderr(io.MultiWriter(&res.stderr, res.journal.Writer(run.StreamStderr))),
 	)
+	res.journal.Flush()
 	if res.err != nil {
 		logrus.WithError(res.err).Warn("error running falcoctl with runner")
 	}
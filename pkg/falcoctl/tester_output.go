@@ -47,10 +47,20 @@ func (t *TestOutput) ExitCode() int {
 		if exitCodeErr, ok := err.(*run.ExitCodeError); ok {
 			return exitCodeErr.Code
 		}
+		if _, ok := err.(*run.SignalError); ok {
+			return -1
+		}
 	}
 	return 0
 }
 
+// Result returns a description of how the falcoctl process terminated,
+// including its exit code, the terminating signal, and whether it
+// dumped a core or exceeded its deadline.
+func (t *TestOutput) Result() *run.ProcessResult {
+	return run.ResultFromError(t.err)
+}
+
 // Stdout returns a string containing the stdout output of the falcoctl run.
 func (t *TestOutput) Stdout() string {
 	return t.stdout.String()
@@ -60,3 +70,24 @@ func (t *TestOutput) Stdout() string {
 func (t *TestOutput) Stderr() string {
 	return t.stderr.String()
 }
+
+// PlainStdout returns a string containing the stdout output of the falcoctl
+// run, without ANSI escape sequences. This is useful when running falcoctl
+// attached to a pseudo-terminal.
+func (t *TestOutput) PlainStdout() string {
+	return run.StripANSI(t.Stdout())
+}
+
+// PlainStderr returns a string containing the stderr output of the falcoctl
+// run, without ANSI escape sequences. This is useful when running falcoctl
+// attached to a pseudo-terminal.
+func (t *TestOutput) PlainStderr() string {
+	return run.StripANSI(t.Stderr())
+}
+
+// Journal returns the combined stdout and stderr output of the falcoctl run,
+// with every line recorded along with its time of arrival and stream of origin.
+// This can be used to check the ordering between lines of different streams.
+func (t *TestOutput) Journal() *run.Journal {
+	return t.journal
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiEscapeRegex matches CSI sequences (e.g. colors and cursor movements),
+// OSC sequences (e.g. window titles and hyperlinks), and two-character
+// escape sequences.
+var ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripANSI removes all the ANSI escape sequences from the given string,
+// and normalizes "\r\n" line endings as "\n". This is useful for inspecting
+// the output of an executable running attached to a pseudo-terminal.
+func StripANSI(s string) string {
+	return strings.ReplaceAll(ansiEscapeRegex.ReplaceAllString(s, ""), "\r\n", "\n")
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const coreDumpPatternPath = "/proc/sys/kernel/core_pattern"
+
+// collectCoreDumps looks for the core dump files produced by the process
+// with the given pid after the given time, and collects them into destDir.
+// Core files are searched accordingly to the kernel's core pattern, which
+// is relative to the process working directory unless absolute.
+// Returns the paths of the collected files.
+func collectCoreDumps(workDir, destDir string, pid int, since time.Time) ([]string, error) {
+	content, err := os.ReadFile(coreDumpPatternPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read core pattern: %s", err.Error())
+	}
+	pattern := strings.TrimSpace(string(content))
+	if strings.HasPrefix(pattern, "|") {
+		return nil, fmt.Errorf("core dumps are piped to '%s' and can't be collected", strings.TrimPrefix(pattern, "|"))
+	}
+
+	srcDir := workDir
+	if filepath.IsAbs(pattern) {
+		srcDir = filepath.Dir(pattern)
+	}
+	prefix := filepath.Base(pattern)
+	if i := strings.Index(prefix, "%"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("can't collect core dumps with core pattern '%s'", pattern)
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+			return res, err
+		}
+		src := filepath.Join(srcDir, entry.Name())
+		dest := filepath.Join(destDir, fmt.Sprintf("%d-%s", pid, entry.Name()))
+		logrus.WithField("src", src).WithField("dest", dest).Debugf("collecting core dump")
+		// files in the working directory would be removed anyway,
+		// so we just move them instead of copying
+		if srcDir == workDir {
+			err = os.Rename(src, dest)
+		} else {
+			err = copyFile(src, dest)
+		}
+		if err != nil {
+			return res, err
+		}
+		res = append(res, dest)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("can't find core dumps in '%s' with core pattern '%s'", srcDir, pattern)
+	}
+	return res, nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// enableCoreDumps raises the soft limit on the core dump file size of
+// the process with the given pid up to its hard limit.
+func enableCoreDumps(pid int) error {
+	var limit unix.Rlimit
+	if err := unix.Prlimit(pid, unix.RLIMIT_CORE, nil, &limit); err != nil {
+		return err
+	}
+	limit.Cur = limit.Max
+	return unix.Prlimit(pid, unix.RLIMIT_CORE, &limit, nil)
+}
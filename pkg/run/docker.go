@@ -23,8 +23,11 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"path"
 	"sync"
 	"time"
@@ -41,6 +44,10 @@ import (
 type DockerRunnerOptions struct {
 	Privileged bool
 	Binds      []string
+	// Tty makes the container run attached to a pseudo-terminal. In this
+	// case, both stdout and stderr are written on the runner's stdout,
+	// the same way they would appear on an interactive terminal.
+	Tty bool
 }
 
 type dockerRunner struct {
@@ -89,6 +96,10 @@ func (d *dockerRunner) WorkDir() string {
 	return "/"
 }
 
+func (d *dockerRunner) CollectsFiles() bool {
+	return true
+}
+
 func (d *dockerRunner) Run(ctx context.Context, options ...RunnerOption) (retErr error) {
 	d.m.Lock()
 	defer d.m.Unlock()
@@ -127,12 +138,74 @@ func (d *dockerRunner) Run(ctx context.Context, options ...RunnerOption) (retErr
 		}
 		defer func() { err = multierr.Append(err, d.stopContainer(cli, containerID)) }()
 
-		// pipe and collect all container outputs
-		_, err = stdcopy.StdCopy(opts.stdout, opts.stderr, hr.Reader)
+		// collect diagnostics if the context deadline exceeds, and
+		// interrupt the output piping in case the context is done.
+		// A graceful stop request lets docker terminate the container,
+		// which ends the output piping as well
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-done:
+			case <-opts.stop:
+				if stopErr := d.stopContainerWithTimeout(cli, containerID, opts.stopGrace); stopErr != nil {
+					logrus.WithError(stopErr).Warn("can't stop docker container gracefully")
+				}
+			case <-ctx.Done():
+				if opts.onHang != nil && ctx.Err() == context.DeadlineExceeded {
+					opts.onHang(d.collectDiagnostics(cli, containerID))
+				}
+				hr.Close()
+			}
+		}()
+
+		// pipe and collect all container outputs.
+		// note: with a tty, the output stream is raw and not multiplexed
+		if d.options.Tty {
+			_, err = io.Copy(opts.stdout, hr.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(opts.stdout, opts.stderr, hr.Reader)
+		}
+		close(done)
+		wg.Wait()
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		for _, f := range opts.collectedFiles {
+			f.callback(d.copyFileFromContainer(cli, containerID, f.name))
+		}
 		return err
 	})
 }
 
+func (d *dockerRunner) collectDiagnostics(cli *client.Client, containerID string) *HangDiagnostics {
+	// note: the context's deadline is done, but we still want to inspect
+	ctx := context.Background()
+	logrus.WithField("containerID", containerID).Debugf("collecting hang diagnostics")
+	res := &HangDiagnostics{Time: time.Now(), FDs: make(map[int]string)}
+	info, raw, err := cli.ContainerInspectWithRaw(ctx, containerID, false)
+	if err != nil {
+		res.Errors = append(res.Errors, err.Error())
+		return res
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		res.ContainerInspect = string(raw)
+	} else {
+		res.ContainerInspect = buf.String()
+	}
+
+	// the container runs on the same host, so its main process
+	// can be inspected through its /proc entries as well
+	if info.State != nil && info.State.Pid > 0 {
+		res.Pid = info.State.Pid
+		res.collectProc()
+	}
+	return res
+}
+
 func (d *dockerRunner) withClient(ctx context.Context, do func(*client.Client) error) error {
 	logrus.Debugf("creating new docker client")
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
@@ -150,13 +223,14 @@ func (d *dockerRunner) createContainer(ctx context.Context, cli *client.Client,
 		env = append(env, fmt.Sprintf(`%s=%s`, k, v))
 	}
 
-	logrus.WithField("image", d.image).WithField("privileged", d.options.Privileged).Debugf("creating new docker container")
+	logrus.WithField("image", d.image).WithField("privileged", d.options.Privileged).WithField("tty", d.options.Tty).Debugf("creating new docker container")
 	resp, err = cli.ContainerCreate(
 		ctx,
 		&container.Config{
 			Image:      d.image,
 			Entrypoint: strslice.StrSlice(append([]string{d.entrypoint}, opts.args...)),
 			Env:        env,
+			Tty:        d.options.Tty,
 		},
 		&container.HostConfig{
 			Privileged: d.options.Privileged,
@@ -188,6 +262,15 @@ func (d *dockerRunner) stopContainer(cli *client.Client, containerID string) err
 	return cli.ContainerStop(ctx, containerID, container.StopOptions{})
 }
 
+// stopContainerWithTimeout stops the container with SIGTERM, and lets docker
+// kill it if it's still running after the given timeout.
+func (d *dockerRunner) stopContainerWithTimeout(cli *client.Client, containerID string, timeout time.Duration) error {
+	ctx := context.Background()
+	seconds := int(math.Ceil(timeout.Seconds()))
+	logrus.WithField("containerID", containerID).Debugf("stopping docker container gracefully")
+	return cli.ContainerStop(ctx, containerID, container.StopOptions{Signal: "SIGTERM", Timeout: &seconds})
+}
+
 func (d *dockerRunner) copyFilesArchive(ctx context.Context, cli *client.Client, containerID string, files []FileAccessor) error {
 	logrus.WithField("containerID", containerID).Debugf("creating files archive")
 	var buf bytes.Buffer
@@ -204,6 +287,32 @@ func (d *dockerRunner) copyFilesArchive(ctx context.Context, cli *client.Client,
 	)
 }
 
+// copyFileFromContainer reads the content of a file from the container,
+// which is still available after it terminated.
+func (d *dockerRunner) copyFileFromContainer(cli *client.Client, containerID, name string) ([]byte, error) {
+	// note: the context's deadline may be done, but we still want to copy
+	ctx := context.Background()
+	if !path.IsAbs(name) {
+		name = d.WorkDir() + "/" + name
+	}
+	logrus.WithField("containerID", containerID).WithField("file", name).Debugf("copying file from docker container")
+	reader, _, err := cli.CopyFromContainer(ctx, containerID, name)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, &os.PathError{Op: "copy", Path: name, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	// the content is archived as a single tar entry
+	tr := tar.NewReader(reader)
+	if _, err := tr.Next(); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(tr)
+}
+
 func (d *dockerRunner) tarFiles(baseDir string, w io.Writer, files ...FileAccessor) (err error) {
 	tw := tar.NewWriter(w)
 	defer func() {
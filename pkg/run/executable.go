@@ -20,25 +20,46 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
 )
 
+// ExecutableRunnerOptions are the options for creating a runner that runs
+// a local executable binary.
+type ExecutableRunnerOptions struct {
+	// PTY makes the executable run attached to a pseudo-terminal. In this
+	// case, both stdout and stderr are written on the runner's stdout,
+	// the same way they would appear on an interactive terminal.
+	PTY bool
+}
+
 type execRunner struct {
 	m          sync.Mutex
 	executable string
 	workDir    string
+	options    ExecutableRunnerOptions
 }
 
 // NewExecutableRunner returns a runner that runs a local executable binary
 func NewExecutableRunner(executable string) (Runner, error) {
+	return NewExecutableRunnerWithOptions(executable, nil)
+}
+
+// NewExecutableRunnerWithOptions returns a runner that runs a local
+// executable binary with the given options
+func NewExecutableRunnerWithOptions(executable string, options *ExecutableRunnerOptions) (Runner, error) {
 	if info, err := os.Stat(executable); err != nil || info.IsDir() {
 		if info.IsDir() {
 			err = fmt.Errorf("file is not an executable")
@@ -49,10 +70,14 @@ func NewExecutableRunner(executable string) (Runner, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &execRunner{
+	res := &execRunner{
 		executable: executable,
 		workDir:    dir,
-	}, nil
+	}
+	if options != nil {
+		res.options = *options
+	}
+	return res, nil
 }
 
 func (e *execRunner) WorkDir() string {
@@ -61,6 +86,14 @@ func (e *execRunner) WorkDir() string {
 	return e.workDir
 }
 
+func (e *execRunner) HostNetwork() bool {
+	return true
+}
+
+func (e *execRunner) CollectsFiles() bool {
+	return true
+}
+
 func (e *execRunner) Run(ctx context.Context, options ...RunnerOption) error {
 	e.m.Lock()
 	defer e.m.Unlock()
@@ -108,13 +141,126 @@ func (e *execRunner) Run(ctx context.Context, options ...RunnerOption) error {
 	cmd.Stdout = opts.stdout
 	cmd.Stderr = opts.stderr
 	cmd.Dir = e.WorkDir()
+	cmd.Cancel = func() error {
+		if opts.onHang != nil && ctx.Err() == context.DeadlineExceeded {
+			logrus.WithField("pid", cmd.Process.Pid).Debugf("collecting hang diagnostics")
+			opts.onHang(collectProcessDiagnostics(cmd.Process.Pid))
+		}
+		return cmd.Process.Kill()
+	}
 	for k, v := range opts.envVars {
 		cmd.Env = append(cmd.Env, fmt.Sprintf(`%s=%s`, k, v))
 	}
 
-	err := cmd.Run()
-	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() != 0 {
-		err = &ExitCodeError{Code: exitErr.ExitCode()}
+	var err error
+	start := time.Now()
+	// closed once the process terminated and got waited
+	exited := make(chan struct{})
+	defer close(exited)
+	if e.options.PTY {
+		err = e.runWithPTY(cmd, opts, exited)
+	} else if err = e.start(cmd, opts, exited); err == nil {
+		err = cmd.Wait()
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && ctx.Err() != nil {
+			// the process has been killed because the context expired
+			err = ctx.Err()
+		} else if ok && status.Signaled() {
+			sigErr := &SignalError{Signal: status.Signal(), CoreDumped: status.CoreDump()}
+			err = sigErr
+			if sigErr.CoreDumped && len(opts.coreDumpDir) > 0 {
+				var collectErr error
+				sigErr.CoreDumps, collectErr = collectCoreDumps(e.WorkDir(), opts.coreDumpDir, cmd.Process.Pid, start)
+				if collectErr != nil {
+					logrus.WithError(collectErr).Warn("can't collect core dumps")
+				}
+			}
+		} else if exitErr.ExitCode() != 0 {
+			err = &ExitCodeError{Code: exitErr.ExitCode()}
+		}
 	}
+	// note: the workdir gets removed once returning
+	collectLocalFiles(e.WorkDir(), opts.collectedFiles)
 	return err
 }
+
+func (e *execRunner) start(cmd *exec.Cmd, opts *runOpts, exited <-chan struct{}) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if len(opts.coreDumpDir) > 0 {
+		if err := enableCoreDumps(cmd.Process.Pid); err != nil {
+			logrus.WithError(err).Warn("can't enable core dumps")
+		}
+	}
+	if opts.stop != nil {
+		go stopGracefully(cmd.Process, opts, exited)
+	}
+	return nil
+}
+
+// stopGracefully sends SIGTERM to the process once the stop channel is
+// closed, and kills it if it doesn't exit within the grace period.
+func stopGracefully(p *os.Process, opts *runOpts, exited <-chan struct{}) {
+	select {
+	case <-exited:
+		return
+	case <-opts.stop:
+	}
+	logrus.WithField("pid", p.Pid).Debugf("stopping process gracefully")
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(opts.stopGrace):
+		logrus.WithField("pid", p.Pid).Warn("process did not stop within its grace period, killing it")
+		p.Kill()
+	}
+}
+
+func (e *execRunner) runWithPTY(cmd *exec.Cmd, opts *runOpts, exited <-chan struct{}) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = ptySysProcAttr()
+	err = e.start(cmd, opts, exited)
+	// the slave end is now owned by the child process
+	slave.Close()
+	if err != nil {
+		return err
+	}
+
+	// the master end returns an error once the child process
+	// and all its descendants close the slave end
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(opts.stdout, master)
+		if isPTYClosedErr(err) || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, os.ErrClosed) {
+			err = nil
+		}
+		copyErr <- err
+	}()
+	err = cmd.Wait()
+
+	// descendants that outlive the child process may keep the slave end
+	// open forever, so the remaining output is drained with a deadline
+	select {
+	case cErr := <-copyErr:
+		return multierr.Append(err, cErr)
+	case <-time.After(ptyDrainTimeout):
+	}
+	if dErr := master.SetReadDeadline(time.Now().Add(ptyDrainTimeout)); dErr != nil {
+		// the master end is not pollable, so closing it is the only
+		// way to interrupt the pending read
+		master.Close()
+	}
+	return multierr.Append(err, <-copyErr)
+}
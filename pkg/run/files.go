@@ -20,6 +20,8 @@ package run
 
 import (
 	"os"
+	"path"
+	"path/filepath"
 )
 
 // FileAccessor is an interface defining a file with given name and content
@@ -71,3 +73,25 @@ func (l *memFileAccessor) Name() string {
 func (l *memFileAccessor) Content() ([]byte, error) {
 	return ([]byte)(l.content), nil
 }
+
+// CollectedFileCallback is invoked with the content of a file collected
+// from a runner (see WithCollectedFile). If Falco didn't create the file,
+// the error satisfies os.IsNotExist.
+type CollectedFileCallback func(content []byte, err error)
+
+type collectedFile struct {
+	name     string
+	callback CollectedFileCallback
+}
+
+// collectLocalFiles collects files from the local filesystem, by resolving
+// relative names in the given base directory.
+func collectLocalFiles(baseDir string, files []collectedFile) {
+	for _, f := range files {
+		name := f.name
+		if !path.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+		f.callback(os.ReadFile(name))
+	}
+}
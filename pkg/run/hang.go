@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThreadDiagnostics is the state of a single thread of a hanging process.
+type ThreadDiagnostics struct {
+	Tid   int
+	Name  string
+	State string
+	WChan string
+	Stack string
+}
+
+// HangDiagnostics is a snapshot of the state of a process taken right
+// before it got killed because its run exceeded the context deadline.
+// Any information that can't be collected (e.g. the kernel stack, which
+// requires privileges) is left empty and the reason is reported in Errors.
+type HangDiagnostics struct {
+	Time time.Time
+	Pid  int
+	// Status is the content of /proc/<pid>/status
+	Status string
+	// WChan is the kernel function in which the process is sleeping
+	WChan string
+	// Stack is the kernel stack of the process
+	Stack   string
+	Threads []ThreadDiagnostics
+	// FDs maps each open file descriptor to the file it refers to
+	FDs map[int]string
+	// ContainerInspect is the JSON output of docker inspect, if the
+	// process was running inside a container
+	ContainerInspect string
+	// OutputTail contains the last lines of output of the process
+	OutputTail []string
+	Errors     []string
+}
+
+// HangDiagnosticsCallback is invoked with the diagnostics collected
+// before killing a process of which run exceeded the context deadline.
+type HangDiagnosticsCallback func(*HangDiagnostics)
+
+func (h *HangDiagnostics) readProcFile(name string) string {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/%s", h.Pid, name))
+	if err != nil {
+		h.Errors = append(h.Errors, err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// collectProcessDiagnostics collects the diagnostics of the process with
+// the given pid by inspecting its /proc entries.
+func collectProcessDiagnostics(pid int) *HangDiagnostics {
+	res := &HangDiagnostics{Time: time.Now(), Pid: pid, FDs: make(map[int]string)}
+	res.collectProc()
+	return res
+}
+
+func (h *HangDiagnostics) collectProc() {
+	h.Status = h.readProcFile("status")
+	h.WChan = h.readProcFile("wchan")
+	h.Stack = h.readProcFile("stack")
+
+	taskDir := fmt.Sprintf("/proc/%d/task", h.Pid)
+	tasks, err := os.ReadDir(taskDir)
+	if err != nil {
+		h.Errors = append(h.Errors, err.Error())
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		thread := ThreadDiagnostics{Tid: tid}
+		name := "task/" + task.Name() + "/"
+		thread.Name = h.readProcFile(name + "comm")
+		thread.WChan = h.readProcFile(name + "wchan")
+		thread.Stack = h.readProcFile(name + "stack")
+		for _, line := range strings.Split(h.readProcFile(name+"status"), "\n") {
+			if strings.HasPrefix(line, "State:") {
+				thread.State = strings.TrimSpace(strings.TrimPrefix(line, "State:"))
+			}
+		}
+		h.Threads = append(h.Threads, thread)
+	}
+
+	fdDir := fmt.Sprintf("/proc/%d/fd", h.Pid)
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		h.Errors = append(h.Errors, err.Error())
+	}
+	for _, fd := range fds {
+		num, err := strconv.Atoi(fd.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil {
+			h.Errors = append(h.Errors, err.Error())
+			continue
+		}
+		h.FDs[num] = target
+	}
+}
+
+// String returns a human-readable report of the diagnostics.
+func (h *HangDiagnostics) String() string {
+	var sb strings.Builder
+	section := func(title, content string) {
+		if len(content) > 0 {
+			sb.WriteString(fmt.Sprintf("--- %s ---\n%s\n", title, content))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("hang diagnostics of pid %d at %s\n", h.Pid, h.Time.Format(time.RFC3339Nano)))
+	section("status", h.Status)
+	section("wchan", h.WChan)
+	section("stack", h.Stack)
+	if len(h.Threads) > 0 {
+		var threads strings.Builder
+		for _, t := range h.Threads {
+			threads.WriteString(fmt.Sprintf("%d %q state=%q wchan=%q\n", t.Tid, t.Name, t.State, t.WChan))
+			if len(t.Stack) > 0 {
+				threads.WriteString(t.Stack + "\n")
+			}
+		}
+		section("threads", strings.TrimSpace(threads.String()))
+	}
+	if len(h.FDs) > 0 {
+		var fds []int
+		for fd := range h.FDs {
+			fds = append(fds, fd)
+		}
+		sort.Ints(fds)
+		var lines []string
+		for _, fd := range fds {
+			lines = append(lines, fmt.Sprintf("%d -> %s", fd, h.FDs[fd]))
+		}
+		section("fds", strings.Join(lines, "\n"))
+	}
+	section("container", h.ContainerInspect)
+	section("output tail", strings.Join(h.OutputTail, "\n"))
+	section("errors", strings.Join(h.Errors, "\n"))
+	return sb.String()
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream identifies an output stream of a process run.
+type Stream int
+
+const (
+	// StreamStdout is the standard output stream
+	StreamStdout Stream = iota
+	// StreamStderr is the standard error stream
+	StreamStderr
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamStdout:
+		return "stdout"
+	case StreamStderr:
+		return "stderr"
+	default:
+		return fmt.Sprintf("stream(%d)", int(s))
+	}
+}
+
+// JournalEntry is a single output line recorded in a Journal.
+type JournalEntry struct {
+	// Time is the instant in which the line was completed. It carries
+	// a monotonic clock reading, so it's safe to use for ordering.
+	Time   time.Time
+	Stream Stream
+	Line   string
+}
+
+// JournalEntries represents a list of journal entries.
+type JournalEntries []*JournalEntry
+
+// Journal records the output lines of one or more streams, each with
+// the time of its arrival and its stream of origin, so that the ordering
+// between lines of different streams can be inspected after a run.
+// A Journal is safe for concurrent use.
+type Journal struct {
+	m       sync.Mutex
+	entries JournalEntries
+	pending map[Stream]*bytes.Buffer
+}
+
+type journalWriter struct {
+	journal *Journal
+	stream  Stream
+}
+
+// NewJournal creates a new empty Journal.
+func NewJournal() *Journal {
+	return &Journal{pending: make(map[Stream]*bytes.Buffer)}
+}
+
+// Writer returns a writer that records in the journal every line written
+// to it as coming from the given stream. Incomplete lines are kept
+// pending until a newline is written or until Flush is invoked.
+func (j *Journal) Writer(s Stream) io.Writer {
+	return &journalWriter{journal: j, stream: s}
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	w.journal.write(w.stream, p)
+	return len(p), nil
+}
+
+func (j *Journal) write(s Stream, p []byte) {
+	j.m.Lock()
+	defer j.m.Unlock()
+	buf, ok := j.pending[s]
+	if !ok {
+		buf = &bytes.Buffer{}
+		j.pending[s] = buf
+	}
+	now := time.Now()
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			buf.Write(p)
+			return
+		}
+		buf.Write(p[:i])
+		j.appendLocked(now, s, buf)
+		p = p[i+1:]
+	}
+}
+
+func (j *Journal) appendLocked(t time.Time, s Stream, buf *bytes.Buffer) {
+	j.entries = append(j.entries, &JournalEntry{
+		Time:   t,
+		Stream: s,
+		Line:   strings.TrimSuffix(buf.String(), "\r"),
+	})
+	buf.Reset()
+}
+
+// Flush records all the pending incomplete lines in the journal.
+func (j *Journal) Flush() {
+	j.m.Lock()
+	defer j.m.Unlock()
+	streams := make([]Stream, 0, len(j.pending))
+	for s := range j.pending {
+		streams = append(streams, s)
+	}
+	// streams are flushed in a stable order, stdout first
+	sort.Slice(streams, func(a, b int) bool { return streams[a] < streams[b] })
+	now := time.Now()
+	for _, s := range streams {
+		if buf := j.pending[s]; buf.Len() > 0 {
+			j.appendLocked(now, s, buf)
+		}
+	}
+}
+
+// Entries returns all the lines recorded in the journal, in order of arrival.
+func (j *Journal) Entries() JournalEntries {
+	j.m.Lock()
+	defer j.m.Unlock()
+	res := make(JournalEntries, len(j.entries))
+	copy(res, j.entries)
+	return res
+}
+
+// String returns the combined output of all streams, one line per entry,
+// in order of arrival.
+func (j *Journal) String() string {
+	return j.Entries().String()
+}
+
+func (e JournalEntries) filter(f func(*JournalEntry) bool) JournalEntries {
+	var res JournalEntries
+	for _, entry := range e {
+		if f(entry) {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+func journalLineMatches(v interface{}, line string) bool {
+	if rgx, ok := v.(*regexp.Regexp); ok {
+		return rgx.MatchString(line)
+	}
+	if str, ok := v.(string); ok {
+		return strings.Contains(line, str)
+	}
+	panic("argument must be string or *regexp.Regexp")
+}
+
+// OfStream returns the list of entries coming from the given stream.
+func (e JournalEntries) OfStream(s Stream) JournalEntries {
+	return e.filter(func(entry *JournalEntry) bool {
+		return entry.Stream == s
+	})
+}
+
+// Matching returns the list of entries of which line matches the given value.
+// The value can either be a string, matched as a substring, or a *regexp.Regexp.
+func (e JournalEntries) Matching(v interface{}) JournalEntries {
+	return e.filter(func(entry *JournalEntry) bool {
+		return journalLineMatches(v, entry.Line)
+	})
+}
+
+// Index returns the index of the first entry of which line matches the
+// given value, or -1 if no entry matches. The value can either be a
+// string, matched as a substring, or a *regexp.Regexp.
+func (e JournalEntries) Index(v interface{}) int {
+	for i, entry := range e {
+		if journalLineMatches(v, entry.Line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// LastIndex returns the index of the last entry of which line matches the
+// given value, or -1 if no entry matches. The value can either be a
+// string, matched as a substring, or a *regexp.Regexp.
+func (e JournalEntries) LastIndex(v interface{}) int {
+	for i := len(e) - 1; i >= 0; i-- {
+		if journalLineMatches(v, e[i].Line) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Before returns true if the first line matching 'first' appears before
+// the first line matching 'then'. Returns false if any of the two
+// has no match. Both values can either be a string, matched as a
+// substring, or a *regexp.Regexp.
+func (e JournalEntries) Before(first, then interface{}) bool {
+	i := e.Index(first)
+	if i < 0 {
+		return false
+	}
+	j := e.Index(then)
+	return j >= 0 && i < j
+}
+
+// After returns true if at least one line matching 'then' appears after
+// the first line matching 'first'. Returns false if any of the two
+// has no match. Both values can either be a string, matched as a
+// substring, or a *regexp.Regexp.
+func (e JournalEntries) After(first, then interface{}) bool {
+	i := e.Index(first)
+	if i < 0 {
+		return false
+	}
+	return e[i+1:].Index(then) >= 0
+}
+
+// Count returns the amount of entries in the list.
+func (e JournalEntries) Count() int {
+	return len(e)
+}
+
+// String returns the lines of all entries joined by newlines.
+func (e JournalEntries) String() string {
+	var sb strings.Builder
+	for _, entry := range e {
+		sb.WriteString(entry.Line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
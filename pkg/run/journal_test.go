@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	j := NewJournal()
+	stdout := j.Writer(StreamStdout)
+	stderr := j.Writer(StreamStderr)
+
+	_, _ = stderr.Write([]byte("starting\nSIGHUP rec"))
+	_, _ = stdout.Write([]byte("alert 1\n"))
+	_, _ = stderr.Write([]byte("eived, restarting...\n"))
+	_, _ = stdout.Write([]byte("alert 2"))
+	j.Flush()
+
+	entries := j.Entries()
+	require.Equal(t, 4, entries.Count())
+	require.Equal(t, "starting\nalert 1\nSIGHUP received, restarting...\nalert 2\n", j.String())
+	require.Equal(t, 2, entries.OfStream(StreamStdout).Count())
+	require.Equal(t, 2, entries.OfStream(StreamStderr).Count())
+	require.True(t, entries.Before("alert 1", "SIGHUP received"))
+	require.False(t, entries.Before("alert 2", "SIGHUP received"))
+	require.True(t, entries.After("SIGHUP received", regexp.MustCompile(`^alert \d$`)))
+	require.False(t, entries.After("alert 2", "alert 1"))
+	require.True(t, entries.After("alert 1", "alert 2"))
+	require.False(t, entries.Before("not there", "alert 1"))
+	require.Equal(t, 3, entries.LastIndex("alert"))
+	for i := 1; i < len(entries); i++ {
+		require.False(t, entries[i].Time.Before(entries[i-1].Time))
+	}
+}
+
+func TestJournalRun(t *testing.T) {
+	runner, err := NewExecutableRunner("/bin/sh")
+	require.Nil(t, err)
+	j := NewJournal()
+	err = runner.Run(
+		context.Background(),
+		WithStdout(j.Writer(StreamStdout)),
+		WithStderr(j.Writer(StreamStderr)),
+		WithArgs("-c", "echo first; sleep 0.1; echo second >&2; sleep 0.1; echo third"),
+	)
+	require.Nil(t, err)
+	j.Flush()
+	entries := j.Entries()
+	require.Equal(t, 3, entries.Count())
+	require.True(t, entries.Before("first", "second"))
+	require.True(t, entries.Before("second", "third"))
+	require.Equal(t, StreamStderr, entries[entries.Index("second")].Stream)
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ptyDefaultRows = 24
+	ptyDefaultCols = 80
+	//
+	// ptyDrainTimeout is how long the output of a pty is read after its
+	// child process exits, in case some descendant keeps it open
+	ptyDrainTimeout = 200 * time.Millisecond
+)
+
+// openPTY opens a new pseudo-terminal pair and returns its master and
+// slave ends. Output post-processing is disabled on the slave end, so
+// that what is read from the master matches exactly what is written by
+// the process (e.g. newlines are not translated into "\r\n").
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't open pty master: %s", err.Error())
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		return nil, nil, fmt.Errorf("can't unlock pty: %s", err.Error())
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't get pty number: %s", err.Error())
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't open pty slave: %s", err.Error())
+	}
+	defer func() {
+		if err != nil {
+			slave.Close()
+		}
+	}()
+
+	sfd := int(slave.Fd())
+	err = unix.IoctlSetWinsize(sfd, unix.TIOCSWINSZ, &unix.Winsize{Row: ptyDefaultRows, Col: ptyDefaultCols})
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't set pty window size: %s", err.Error())
+	}
+	termios, err := unix.IoctlGetTermios(sfd, unix.TCGETS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't get pty attributes: %s", err.Error())
+	}
+	termios.Oflag &^= unix.OPOST
+	if err = unix.IoctlSetTermios(sfd, unix.TCSETS, termios); err != nil {
+		return nil, nil, fmt.Errorf("can't set pty attributes: %s", err.Error())
+	}
+	return master, slave, nil
+}
+
+// ptySysProcAttr returns the process attributes required for a process
+// to have the pty slave end (attached as its stdin) as controlling terminal.
+func ptySysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+// isPTYClosedErr returns true if the error is the one returned when
+// reading from a pty master after all its slave ends have been closed.
+func isPTYClosedErr(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.EIO
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+//go:build !linux
+
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const ptyDrainTimeout = 0
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("pseudo-terminals are only supported on linux")
+}
+
+func ptySysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func isPTYClosedErr(err error) bool {
+	return false
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"go.uber.org/multierr"
+)
+
+// SignalError is an error representing the termination of a process
+// due to a signal
+type SignalError struct {
+	Signal     syscall.Signal
+	CoreDumped bool
+	// CoreDumps contains the paths of the core dump files collected
+	// after the process termination, if requested with WithCoreDumpDir
+	CoreDumps []string
+}
+
+func (s *SignalError) Error() string {
+	msg := fmt.Sprintf("terminated by signal %d (%s)", int(s.Signal), s.Signal.String())
+	if s.CoreDumped {
+		msg += " (core dumped)"
+	}
+	return msg
+}
+
+// ProcessResult describes how a process run terminated
+type ProcessResult struct {
+	// ExitCode is the exit code of the process, or -1 if the process
+	// did not exit normally (e.g. terminated by a signal or killed
+	// after the context deadline exceeded)
+	ExitCode int
+	// Signal is the signal that terminated the process, or 0 if the
+	// process was not terminated by a signal
+	Signal syscall.Signal
+	// CoreDumped is true if the process dumped a core on termination
+	CoreDumped bool
+	// TimedOut is true if the process was killed because the context
+	// deadline exceeded
+	TimedOut bool
+	// CoreDumps contains the paths of the collected core dump files
+	CoreDumps []string
+}
+
+// crashSignals are the signals that are sent to a process because
+// of a fault, as opposed to the ones sent by other processes
+var crashSignals = map[syscall.Signal]bool{
+	syscall.SIGSEGV: true,
+	syscall.SIGABRT: true,
+	syscall.SIGBUS:  true,
+	syscall.SIGFPE:  true,
+	syscall.SIGILL:  true,
+	syscall.SIGSYS:  true,
+	syscall.SIGTRAP: true,
+}
+
+// ResultFromError builds a ProcessResult from an error returned
+// by Runner.Run.
+func ResultFromError(err error) *ProcessResult {
+	res := &ProcessResult{}
+	for _, e := range multierr.Errors(err) {
+		switch v := e.(type) {
+		case *ExitCodeError:
+			res.ExitCode = v.Code
+		case *SignalError:
+			res.ExitCode = -1
+			res.Signal = v.Signal
+			res.CoreDumped = v.CoreDumped
+			res.CoreDumps = append(res.CoreDumps, v.CoreDumps...)
+		default:
+			if e == context.DeadlineExceeded {
+				res.ExitCode = -1
+				res.TimedOut = true
+			}
+		}
+	}
+	return res
+}
+
+// Signaled returns true if the process was terminated by a signal.
+func (p *ProcessResult) Signaled() bool {
+	return p.Signal != 0
+}
+
+// Crashed returns true if the process terminated abnormally because of
+// a fault, such as a segmentation fault or an abort, or dumped a core.
+func (p *ProcessResult) Crashed() bool {
+	return p.CoreDumped || crashSignals[p.Signal]
+}
+
+func (p *ProcessResult) String() string {
+	var parts []string
+	switch {
+	case p.TimedOut:
+		parts = append(parts, "timed out")
+	case p.Signaled():
+		parts = append(parts, fmt.Sprintf("terminated by signal %d (%s)", int(p.Signal), p.Signal.String()))
+	default:
+		parts = append(parts, fmt.Sprintf("exited with code %d", p.ExitCode))
+	}
+	if p.CoreDumped {
+		parts = append(parts, "core dumped")
+	}
+	return strings.Join(parts, ", ")
+}
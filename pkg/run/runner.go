@@ -22,14 +22,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 )
 
 type runOpts struct {
-	stderr  io.Writer
-	stdout  io.Writer
-	args    []string
-	files   []FileAccessor
-	envVars map[string]string
+	stderr          io.Writer
+	stdout          io.Writer
+	args            []string
+	files           []FileAccessor
+	envVars         map[string]string
+	coreDumpDir     string
+	onHang          HangDiagnosticsCallback
+	onWrapperReport WrapperReportCallback
+	stop            <-chan struct{}
+	stopGrace       time.Duration
+	collectedFiles  []collectedFile
 }
 
 // RunnerOption is an option for running Falco
@@ -46,6 +53,45 @@ type Runner interface {
 	WorkDir() string
 }
 
+// HostNetworkRunner is a Runner that can tell whether Falco runs in the
+// network namespace of the host.
+type HostNetworkRunner interface {
+	Runner
+	// HostNetwork returns true if Falco runs in the network namespace of
+	// the host, so that the ports it listens on can be reached from the
+	// host on the same addresses.
+	HostNetwork() bool
+}
+
+// SharesHostNetwork returns true if the given runner runs Falco in the
+// network namespace of the host (see HostNetworkRunner). Runners not
+// implementing HostNetworkRunner are assumed not to.
+func SharesHostNetwork(r Runner) bool {
+	if n, ok := r.(HostNetworkRunner); ok {
+		return n.HostNetwork()
+	}
+	return false
+}
+
+// FileCollectorRunner is a Runner that can tell whether it supports
+// collecting the files written by Falco (see WithCollectedFile).
+type FileCollectorRunner interface {
+	Runner
+	// CollectsFiles returns true if the runner invokes the callbacks of
+	// WithCollectedFile once Falco terminates.
+	CollectsFiles() bool
+}
+
+// CollectsFiles returns true if the given runner supports collecting the
+// files written by Falco (see FileCollectorRunner). Runners not
+// implementing FileCollectorRunner are assumed not to.
+func CollectsFiles(r Runner) bool {
+	if c, ok := r.(FileCollectorRunner); ok {
+		return c.CollectsFiles()
+	}
+	return false
+}
+
 // WithFiles is an option for running Falco with some files
 // to be used during execution and/or referenced in the CLI args
 // (e.g. rules files, config files, capture files, etc...).
@@ -81,6 +127,53 @@ func WithEnvVars(vars map[string]string) RunnerOption {
 	}
 }
 
+// WithCoreDumpDir is an option for running Falco by collecting the core
+// dumps produced in case of a crash into the given directory, which is
+// created if not existing. The collected files are reported in the
+// returned SignalError. Only supported by the executable runner.
+func WithCoreDumpDir(dir string) RunnerOption {
+	return func(ro *runOpts) { ro.coreDumpDir = dir }
+}
+
+// WithHangDiagnostics is an option for running Falco by collecting
+// diagnostics about its state in case the context deadline exceeds,
+// right before the process gets killed. The given callback is invoked
+// with the collected diagnostics before Run returns.
+func WithHangDiagnostics(f HangDiagnosticsCallback) RunnerOption {
+	return func(ro *runOpts) { ro.onHang = f }
+}
+
+// WithWrapperReport is an option for running Falco by receiving the report
+// produced by the instrumentation tool of a wrapper runner. The given callback
+// is invoked with the report before Run returns. Ignored by other runners.
+func WithWrapperReport(f WrapperReportCallback) RunnerOption {
+	return func(ro *runOpts) { ro.onWrapperReport = f }
+}
+
+// WithGracefulStop is an option for running Falco by stopping it gracefully
+// once the given channel is closed. Falco is first asked to terminate with
+// SIGTERM, and is killed only if it's still running after the given grace
+// period. Unlike the context expiration, this gives Falco the chance of
+// going through its shutdown sequence.
+func WithGracefulStop(stop <-chan struct{}, grace time.Duration) RunnerOption {
+	return func(ro *runOpts) {
+		ro.stop = stop
+		ro.stopGrace = grace
+	}
+}
+
+// WithCollectedFile is an option for running Falco by collecting a file it
+// writes during its execution, such as the file of an output channel. If
+// the file's name is a relative path, it is resolved in the working
+// directory of the runner. Once Falco terminates, the given callback is
+// invoked with the content of the file before Run returns. Ignored by
+// runners not supporting it (see CollectsFiles).
+func WithCollectedFile(name string, f CollectedFileCallback) RunnerOption {
+	return func(ro *runOpts) {
+		ro.collectedFiles = append(ro.collectedFiles, collectedFile{name: name, callback: f})
+	}
+}
+
 // ExitCodeError is an error representing the exit code of Falco
 type ExitCodeError struct {
 	Code int
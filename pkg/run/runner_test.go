@@ -21,7 +21,12 @@ package run
 import (
 	"bytes"
 	"context"
+	"io"
+	"os"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
@@ -55,6 +60,35 @@ func TestFileAccess(t *testing.T) {
 	}
 }
 
+func TestCollectedFiles(t *testing.T) {
+	runners := map[string]func() (Runner, error){
+		"executable": func() (Runner, error) { return NewExecutableRunner("/bin/sh") },
+		"docker":     func() (Runner, error) { return NewDockerRunner(testDockerImage, "/bin/sh", nil) },
+	}
+	for rName, rCons := range runners {
+		t.Run(rName, func(t *testing.T) {
+			runner, err := rCons()
+			require.Nil(t, err)
+			require.True(t, CollectsFiles(runner))
+			var content []byte
+			var missingErr error
+			err = runner.Run(
+				context.Background(),
+				WithArgs("-c", "echo 'hello world' > "+runner.WorkDir()+"/some-file"),
+				WithCollectedFile("some-file", func(c []byte, err error) {
+					require.Nil(t, err)
+					content = c
+				}),
+				WithCollectedFile("missing-file", func(c []byte, err error) { missingErr = err }),
+			)
+			require.Nil(t, err)
+			require.Equal(t, "hello world\n", string(content))
+			require.True(t, os.IsNotExist(missingErr))
+		})
+	}
+	require.False(t, CollectsFiles(struct{ Runner }{}))
+}
+
 func TestInputOutput(t *testing.T) {
 	logrus.SetLevel(logrus.DebugLevel)
 	runners := map[string]func() (Runner, error){
@@ -77,3 +111,134 @@ func TestInputOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestPTY(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("pseudo-terminals are not available")
+	}
+	script := `if [ -t 1 ]; then printf '\033[1;32mtty\033[0m\n'; else echo notty; fi; echo err >&2`
+	t.Run("enabled", func(t *testing.T) {
+		runner, err := NewExecutableRunnerWithOptions("/bin/sh", &ExecutableRunnerOptions{PTY: true})
+		require.Nil(t, err)
+		var out bytes.Buffer
+		err = runner.Run(context.Background(), WithStdout(&out), WithArgs("-c", script))
+		require.Nil(t, err)
+		require.Equal(t, "\033[1;32mtty\033[0m\nerr\n", out.String())
+		require.Equal(t, "tty\nerr\n", StripANSI(out.String()))
+	})
+	t.Run("disabled", func(t *testing.T) {
+		runner, err := NewExecutableRunner("/bin/sh")
+		require.Nil(t, err)
+		var out bytes.Buffer
+		err = runner.Run(context.Background(), WithStdout(&out), WithArgs("-c", script))
+		require.Nil(t, err)
+		require.Equal(t, "notty\n", out.String())
+	})
+	t.Run("exit-code", func(t *testing.T) {
+		runner, err := NewExecutableRunnerWithOptions("/bin/sh", &ExecutableRunnerOptions{PTY: true})
+		require.Nil(t, err)
+		err = runner.Run(context.Background(), WithArgs("-c", "exit 3"))
+		require.Equal(t, &ExitCodeError{Code: 3}, err)
+	})
+	t.Run("background-descendant", func(t *testing.T) {
+		runner, err := NewExecutableRunnerWithOptions("/bin/sh", &ExecutableRunnerOptions{PTY: true})
+		require.Nil(t, err)
+		var out bytes.Buffer
+		start := time.Now()
+		err = runner.Run(context.Background(), WithStdout(&out), WithArgs("-c", "sleep 5 & echo done"))
+		require.Nil(t, err)
+		require.Equal(t, "done\n", out.String())
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+}
+
+func TestProcessResult(t *testing.T) {
+	runner, err := NewExecutableRunner("/bin/sh")
+	require.Nil(t, err)
+
+	err = runner.Run(context.Background(), WithArgs("-c", "exit 2"))
+	res := ResultFromError(err)
+	require.Equal(t, 2, res.ExitCode)
+	require.False(t, res.Signaled())
+	require.False(t, res.Crashed())
+
+	err = runner.Run(context.Background(), WithArgs("-c", "kill -SEGV $$"))
+	require.IsType(t, &SignalError{}, err)
+	res = ResultFromError(err)
+	require.Equal(t, -1, res.ExitCode)
+	require.Equal(t, syscall.SIGSEGV, res.Signal)
+	require.True(t, res.Crashed())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = runner.Run(ctx, WithArgs("-c", "exec sleep 5"))
+	res = ResultFromError(err)
+	require.True(t, res.TimedOut)
+	require.False(t, res.Crashed())
+}
+
+func TestHangDiagnostics(t *testing.T) {
+	runner, err := NewExecutableRunner("/bin/sh")
+	require.Nil(t, err)
+	var diag *HangDiagnostics
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = runner.Run(ctx,
+		WithArgs("-c", "exec sleep 5"),
+		WithHangDiagnostics(func(h *HangDiagnostics) { diag = h }),
+	)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.NotNil(t, diag)
+	require.NotZero(t, diag.Pid)
+	require.Contains(t, diag.Status, "sleep")
+	require.Len(t, diag.Threads, 1)
+	require.Contains(t, diag.String(), "hang diagnostics of pid")
+}
+
+func TestGracefulStop(t *testing.T) {
+	runner, err := NewExecutableRunner("/bin/sh")
+	require.Nil(t, err)
+
+	// the process receives SIGTERM and can shut down on its own
+	var out bytes.Buffer
+	stop := make(chan struct{})
+	err = runner.Run(context.Background(),
+		WithArgs("-c", "trap 'echo bye; exit 0' TERM; echo ready; while true; do sleep 0.05; done"),
+		WithStdout(&stopOnWrite{w: &out, stop: stop}),
+		WithGracefulStop(stop, 5*time.Second),
+	)
+	require.Nil(t, err)
+	require.Equal(t, "ready\nbye\n", out.String())
+
+	// the process ignores SIGTERM and gets killed after the grace period
+	stop = make(chan struct{})
+	start := time.Now()
+	err = runner.Run(context.Background(),
+		WithArgs("-c", "trap '' TERM; echo ready; exec sleep 5"),
+		WithStdout(&stopOnWrite{w: io.Discard, stop: stop}),
+		WithGracefulStop(stop, 100*time.Millisecond),
+	)
+	require.Less(t, time.Since(start), 2*time.Second)
+	res := ResultFromError(err)
+	require.Equal(t, syscall.SIGKILL, res.Signal)
+	require.False(t, res.TimedOut)
+
+	// the stop channel is never closed
+	err = runner.Run(context.Background(),
+		WithArgs("-c", "exit 0"),
+		WithGracefulStop(make(chan struct{}), time.Second),
+	)
+	require.Nil(t, err)
+}
+
+// stopOnWrite is a writer closing the stop channel at the first write
+type stopOnWrite struct {
+	w    io.Writer
+	stop chan struct{}
+	once sync.Once
+}
+
+func (s *stopOnWrite) Write(p []byte) (int, error) {
+	s.once.Do(func() { close(s.stop) })
+	return s.w.Write(p)
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Valgrind memcheck error kinds related to memory leaks
+const (
+	ValgrindLeakDefinitelyLost = "Leak_DefinitelyLost"
+	ValgrindLeakIndirectlyLost = "Leak_IndirectlyLost"
+	ValgrindLeakPossiblyLost   = "Leak_PossiblyLost"
+	ValgrindLeakStillReachable = "Leak_StillReachable"
+)
+
+// ValgrindFrame is a single frame of a stack trace reported by valgrind.
+type ValgrindFrame struct {
+	IP   string `xml:"ip"`
+	Obj  string `xml:"obj"`
+	Fn   string `xml:"fn"`
+	Dir  string `xml:"dir"`
+	File string `xml:"file"`
+	Line int    `xml:"line"`
+}
+
+func (f *ValgrindFrame) String() string {
+	var sb strings.Builder
+	sb.WriteString(f.IP + ": ")
+	if len(f.Fn) > 0 {
+		sb.WriteString(f.Fn)
+	} else {
+		sb.WriteString("???")
+	}
+	if len(f.File) > 0 {
+		sb.WriteString(fmt.Sprintf(" (%s:%d)", f.File, f.Line))
+	} else if len(f.Obj) > 0 {
+		sb.WriteString(fmt.Sprintf(" (in %s)", f.Obj))
+	}
+	return sb.String()
+}
+
+// ValgrindError is a single error reported by valgrind memcheck, such
+// as an invalid memory access or a memory leak.
+type ValgrindError struct {
+	Unique string `xml:"unique"`
+	Tid    int    `xml:"tid"`
+	Kind   string `xml:"kind"`
+	// What is the description of non-leak errors
+	What string `xml:"what"`
+	// XWhat is the description of leak errors, with the leaked amounts
+	XWhat struct {
+		Text         string `xml:"text"`
+		LeakedBytes  int64  `xml:"leakedbytes"`
+		LeakedBlocks int64  `xml:"leakedblocks"`
+	} `xml:"xwhat"`
+	Stack []ValgrindFrame `xml:"stack>frame"`
+}
+
+// Description returns the human-readable description of the error.
+func (e *ValgrindError) Description() string {
+	if len(e.What) > 0 {
+		return e.What
+	}
+	return e.XWhat.Text
+}
+
+// IsLeak returns true if the error is a memory leak.
+func (e *ValgrindError) IsLeak() bool {
+	return strings.HasPrefix(e.Kind, "Leak_")
+}
+
+func (e *ValgrindError) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s: %s\n", e.Kind, e.Description()))
+	for _, f := range e.Stack {
+		sb.WriteString("    at " + f.String() + "\n")
+	}
+	return sb.String()
+}
+
+// ValgrindErrors represents a list of errors reported by valgrind memcheck.
+type ValgrindErrors []*ValgrindError
+
+// ValgrindReport is the report of valgrind memcheck in its XML format.
+type ValgrindReport struct {
+	ProtocolVersion int            `xml:"protocolversion"`
+	Pid             int            `xml:"pid"`
+	Tool            string         `xml:"tool"`
+	Errors          ValgrindErrors `xml:"error"`
+}
+
+func isValgrindXML(content []byte) bool {
+	return bytes.Contains(content, []byte("<valgrindoutput>"))
+}
+
+// ParseValgrindXML parses the XML output of valgrind memcheck
+// (i.e. produced with `--xml=yes`).
+func ParseValgrindXML(content []byte) (*ValgrindReport, error) {
+	res := &ValgrindReport{}
+	if err := xml.Unmarshal(content, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (e ValgrindErrors) filter(f func(*ValgrindError) bool) ValgrindErrors {
+	var res ValgrindErrors
+	for _, err := range e {
+		if f(err) {
+			res = append(res, err)
+		}
+	}
+	return res
+}
+
+// OfKind returns the list of errors of the given kind.
+func (e ValgrindErrors) OfKind(kind string) ValgrindErrors {
+	return e.filter(func(err *ValgrindError) bool {
+		return err.Kind == kind
+	})
+}
+
+// Leaks returns the list of errors that are memory leaks.
+func (e ValgrindErrors) Leaks() ValgrindErrors {
+	return e.filter(func(err *ValgrindError) bool {
+		return err.IsLeak()
+	})
+}
+
+// NonLeaks returns the list of errors that are not memory leaks,
+// such as invalid reads, invalid writes, and uses of uninitialized values.
+func (e ValgrindErrors) NonLeaks() ValgrindErrors {
+	return e.filter(func(err *ValgrindError) bool {
+		return !err.IsLeak()
+	})
+}
+
+// LeakedBytes returns the total amount of bytes leaked in the list of errors.
+func (e ValgrindErrors) LeakedBytes() int64 {
+	var res int64
+	for _, err := range e {
+		res += err.XWhat.LeakedBytes
+	}
+	return res
+}
+
+// Count returns the amount of errors in the list.
+func (e ValgrindErrors) Count() int {
+	return len(e)
+}
+
+func (e ValgrindErrors) String() string {
+	var sb strings.Builder
+	for _, err := range e {
+		sb.WriteString(err.String())
+	}
+	return sb.String()
+}
+
+func (e ValgrindErrors) asError(what string) error {
+	if len(e) == 0 {
+		return nil
+	}
+	return fmt.Errorf("valgrind reported %d %s:\n%s", len(e), what, e.String())
+}
+
+// NoDefinitelyLostLeaks returns a non-nil error describing all the
+// definitely lost memory leaks of the report, if any.
+func (r *ValgrindReport) NoDefinitelyLostLeaks() error {
+	return r.Errors.OfKind(ValgrindLeakDefinitelyLost).asError("definitely lost leaks")
+}
+
+// NoLeaks returns a non-nil error describing all the definitely,
+// indirectly, and possibly lost memory leaks of the report, if any.
+func (r *ValgrindReport) NoLeaks() error {
+	return r.Errors.filter(func(err *ValgrindError) bool {
+		return err.IsLeak() && err.Kind != ValgrindLeakStillReachable
+	}).asError("leaks")
+}
+
+// NoMemoryErrors returns a non-nil error describing all the errors of
+// the report that are not memory leaks, if any.
+func (r *ValgrindReport) NoMemoryErrors() error {
+	return r.Errors.NonLeaks().asError("memory errors")
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/multierr"
+)
+
+const wrapperReportPrefix = "falcosecurity-testing-report-"
+
+// WrapperTool describes an instrumentation tool of which command line
+// prefixes the executable run by a wrapper runner.
+type WrapperTool struct {
+	// Command is the tool command line. The executable and its arguments
+	// are appended after it.
+	Command []string
+	// ReportArg is an optional argument telling the tool where to write
+	// its report. It must contain a single "%s" verb, which is replaced
+	// with the path of a temporary report file.
+	ReportArg string
+}
+
+var (
+	// ValgrindMemcheckTool runs the executable under the valgrind memcheck
+	// tool, reporting errors and leaks in the valgrind XML format.
+	ValgrindMemcheckTool = &WrapperTool{
+		Command:   []string{"valgrind", "--tool=memcheck", "--leak-check=full", "--xml=yes"},
+		ReportArg: "--xml-file=%s",
+	}
+	//
+	// StraceTool runs the executable under strace, following forks.
+	StraceTool = &WrapperTool{
+		Command:   []string{"strace", "-f"},
+		ReportArg: "-o%s",
+	}
+	//
+	// LtraceTool runs the executable under ltrace, following forks.
+	LtraceTool = &WrapperTool{
+		Command:   []string{"ltrace", "-f"},
+		ReportArg: "-o%s",
+	}
+)
+
+// WrapperReport is the report produced by the tool of a wrapper runner.
+type WrapperReport struct {
+	// Tool is the name of the wrapping tool
+	Tool string
+	// Content is the raw content of the report written by the tool
+	Content []byte
+	// Valgrind is the parsed report of valgrind memcheck, or nil
+	// if the report is not in the valgrind XML format
+	Valgrind *ValgrindReport
+}
+
+// WrapperReportCallback is invoked with the report produced by the tool
+// of a wrapper runner after the run finishes.
+type WrapperReportCallback func(*WrapperReport)
+
+type wrapperRunner struct {
+	runner     Runner
+	executable string
+	tool       WrapperTool
+}
+
+// NewWrapperRunner returns a runner that runs a local executable binary
+// under the given instrumentation tool, such as valgrind or strace.
+func NewWrapperRunner(executable string, tool *WrapperTool) (Runner, error) {
+	if tool == nil || len(tool.Command) == 0 {
+		return nil, fmt.Errorf("wrapper tool command must not be empty")
+	}
+	if len(tool.ReportArg) > 0 && strings.Count(tool.ReportArg, "%s") != 1 {
+		return nil, fmt.Errorf("wrapper tool report arg must contain exactly one '%%s': %s", tool.ReportArg)
+	}
+	if info, err := os.Stat(executable); err != nil || info.IsDir() {
+		if err == nil {
+			err = fmt.Errorf("file is not an executable")
+		}
+		return nil, fmt.Errorf("can't access executable '%s': %s", executable, err.Error())
+	}
+	toolPath, err := exec.LookPath(tool.Command[0])
+	if err != nil {
+		return nil, fmt.Errorf("can't find wrapper tool '%s': %s", tool.Command[0], err.Error())
+	}
+	runner, err := NewExecutableRunner(toolPath)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperRunner{
+		runner:     runner,
+		executable: executable,
+		tool:       *tool,
+	}, nil
+}
+
+func (w *wrapperRunner) WorkDir() string {
+	return w.runner.WorkDir()
+}
+
+func (w *wrapperRunner) HostNetwork() bool {
+	return SharesHostNetwork(w.runner)
+}
+
+func (w *wrapperRunner) CollectsFiles() bool {
+	return CollectsFiles(w.runner)
+}
+
+func (w *wrapperRunner) Run(ctx context.Context, options ...RunnerOption) error {
+	opts := buildRunOptions(options...)
+	args := append([]string{}, w.tool.Command[1:]...)
+	var reportPath string
+	if len(w.tool.ReportArg) > 0 {
+		f, err := os.CreateTemp("", wrapperReportPrefix)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		reportPath = f.Name()
+		defer os.Remove(reportPath)
+		args = append(args, fmt.Sprintf(w.tool.ReportArg, reportPath))
+	}
+	args = append(args, w.executable)
+
+	err := w.runner.Run(ctx, append([]RunnerOption{WithArgs(args...)}, options...)...)
+	if len(reportPath) > 0 && opts.onWrapperReport != nil {
+		report, reportErr := newWrapperReport(filepath.Base(w.tool.Command[0]), reportPath)
+		if reportErr != nil {
+			return multierr.Append(err, reportErr)
+		}
+		opts.onWrapperReport(report)
+	}
+	return err
+}
+
+func newWrapperReport(tool, path string) (*WrapperReport, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s report: %s", tool, err.Error())
+	}
+	res := &WrapperReport{Tool: tool, Content: content}
+	if isValgrindXML(content) {
+		res.Valgrind, err = ParseValgrindXML(content)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s report: %s", tool, err.Error())
+		}
+	}
+	return res, nil
+}
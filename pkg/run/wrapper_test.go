@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testValgrindXML = `<?xml version="1.0"?>
+<valgrindoutput>
+<protocolversion>4</protocolversion>
+<protocoltool>memcheck</protocoltool>
+<pid>1234</pid>
+<tool>memcheck</tool>
+<error>
+  <unique>0x0</unique>
+  <tid>1</tid>
+  <kind>InvalidRead</kind>
+  <what>Invalid read of size 4</what>
+  <stack>
+    <frame><ip>0x4005F4</ip><obj>/usr/bin/falco</obj><fn>main</fn><dir>/src</dir><file>main.c</file><line>6</line></frame>
+  </stack>
+</error>
+<error>
+  <unique>0x1</unique>
+  <tid>1</tid>
+  <kind>Leak_DefinitelyLost</kind>
+  <xwhat>
+    <text>40 bytes in 1 blocks are definitely lost in loss record 1 of 2</text>
+    <leakedbytes>40</leakedbytes>
+    <leakedblocks>1</leakedblocks>
+  </xwhat>
+  <stack>
+    <frame><ip>0x4C2DB8F</ip><obj>/usr/lib/valgrind/vgpreload_memcheck-amd64-linux.so</obj><fn>malloc</fn></frame>
+    <frame><ip>0x4005E6</ip><obj>/usr/bin/falco</obj><fn>main</fn><dir>/src</dir><file>main.c</file><line>5</line></frame>
+  </stack>
+</error>
+<error>
+  <unique>0x2</unique>
+  <tid>1</tid>
+  <kind>Leak_StillReachable</kind>
+  <xwhat>
+    <text>8 bytes in 1 blocks are still reachable in loss record 2 of 2</text>
+    <leakedbytes>8</leakedbytes>
+    <leakedblocks>1</leakedblocks>
+  </xwhat>
+</error>
+</valgrindoutput>
+`
+
+func TestValgrindXML(t *testing.T) {
+	report, err := ParseValgrindXML([]byte(testValgrindXML))
+	require.Nil(t, err)
+	require.Equal(t, 1234, report.Pid)
+	require.Equal(t, 3, report.Errors.Count())
+	require.Equal(t, 2, report.Errors.Leaks().Count())
+	require.Equal(t, 1, report.Errors.NonLeaks().Count())
+	require.Equal(t, int64(48), report.Errors.Leaks().LeakedBytes())
+	require.Equal(t, "Invalid read of size 4", report.Errors.NonLeaks()[0].Description())
+	require.Equal(t, 6, report.Errors.NonLeaks()[0].Stack[0].Line)
+	require.Error(t, report.NoMemoryErrors())
+	require.Error(t, report.NoLeaks())
+	err = report.NoDefinitelyLostLeaks()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "40 bytes in 1 blocks are definitely lost")
+	require.Contains(t, err.Error(), "main (main.c:5)")
+
+	report.Errors = report.Errors.OfKind(ValgrindLeakStillReachable)
+	require.Nil(t, report.NoDefinitelyLostLeaks())
+	require.Nil(t, report.NoLeaks())
+	require.Nil(t, report.NoMemoryErrors())
+}
+
+func TestWrapperRunner(t *testing.T) {
+	// a fake tool writing a valgrind report and then running the executable
+	tool := &WrapperTool{
+		Command:   []string{"sh", "-c", `printf '%s' "$VALGRIND_XML" > "${0#--xml-file=}" && exec "$@"`},
+		ReportArg: "--xml-file=%s",
+	}
+	runner, err := NewWrapperRunner("/bin/echo", tool)
+	require.Nil(t, err)
+	var out bytes.Buffer
+	var report *WrapperReport
+	err = runner.Run(
+		context.Background(),
+		WithStdout(&out),
+		WithArgs("hello", "world"),
+		WithEnvVars(map[string]string{"VALGRIND_XML": testValgrindXML}),
+		WithWrapperReport(func(r *WrapperReport) { report = r }),
+	)
+	require.Nil(t, err)
+	require.Equal(t, "hello world\n", out.String())
+	require.NotNil(t, report)
+	require.Equal(t, "sh", report.Tool)
+	require.NotNil(t, report.Valgrind)
+	require.Equal(t, 3, report.Valgrind.Errors.Count())
+}
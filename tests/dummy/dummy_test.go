@@ -8,8 +8,6 @@ import (
 	"github.com/falcosecurity/testing/tests/data/rules"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"net/http"
-	"sync"
 	"testing"
 	"time"
 )
@@ -20,7 +18,7 @@ func runFalcoWithDummy(t *testing.T, r run.Runner, opts ...falco.TestOption) *fa
 		&falco.PluginConfigInfo{
 			Name:       "dummy",
 			Library:    plugins.DummyPlugin.Name(),
-			OpenParams: `'{"start": 1, "maxEvents": 2000000000}'`,
+			OpenParams: `{"start": 1, "maxEvents": 2000000000}`,
 		},
 	)
 	require.Nil(t, err)
@@ -34,29 +32,16 @@ func runFalcoWithDummy(t *testing.T, r run.Runner, opts ...falco.TestOption) *fa
 }
 
 func TestDummy_PrometheusMetrics(t *testing.T) {
-	var (
-		wg         sync.WaitGroup
-		metricsErr error
-	)
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		time.Sleep(2 * time.Second)
-		_, metricsErr = http.Get("http://127.0.0.1:8765/metrics")
-	}()
-
+	t.Parallel()
 	falcoRes := runFalcoWithDummy(t,
 		tests.NewFalcoExecutableRunner(t),
-		falco.WithPrometheusMetrics(),
+		falco.WithMetricsScraping(time.Second),
 		falco.WithRules(rules.SingleRule),
 		falco.WithStopAfter(5*time.Second),
-		falco.WithArgs("-o", "engine.kind=nodriver"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineNoDriver}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
-
-	wg.Wait()
-
-	assert.NoError(t, metricsErr)
+	assert.NoError(t, falcoRes.Metrics().Err)
+	assert.NotNil(t, falcoRes.Metrics().Final())
 }
@@ -278,7 +278,7 @@ func TestFalco_Print_Rules(t *testing.T) {
 		assert.Equal(t, "A process named cat does an open", infos.Rules[0].Info.Description)
 		assert.Equal(t, "An open was seen (command=%proc.cmdline)", infos.Rules[0].Info.Output)
 		assert.Equal(t, true, infos.Rules[0].Info.Enabled)
-		assert.Equal(t, "Warning", infos.Rules[0].Info.Priority)
+		assert.Equal(t, falco.PriorityWarning, infos.Rules[0].Info.Priority)
 		assert.Equal(t, "syscall", infos.Rules[0].Info.Source)
 		assert.Empty(t, infos.Rules[0].Info.Tags)
 		require.Len(t, infos.Rules[0].Details.Plugins, 1)
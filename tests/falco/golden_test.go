@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: Apache-2.0
+/*
+Copyright (C) 2023 The Falco Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+
+*/
+
+package testfalco
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/falcosecurity/testing/pkg/falco"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+func init() {
+	// golden files are embedded so that the compiled test binary
+	// can run from any directory, unless they're being updated
+	golden, err := fs.Sub(testdata, "testdata")
+	if err != nil {
+		panic(err)
+	}
+	falco.GoldenFS = golden
+}
@@ -38,14 +38,10 @@ package testfalco
 import (
 	"bufio"
 	"bytes"
-	"strings"
 	"testing"
 	"time"
 
-	grpcOutputs "github.com/falcosecurity/client-go/pkg/api/outputs"
-
 	"github.com/falcosecurity/testing/pkg/falco"
-	"github.com/falcosecurity/testing/pkg/run"
 	"github.com/falcosecurity/testing/tests"
 	"github.com/falcosecurity/testing/tests/data/captures"
 	"github.com/falcosecurity/testing/tests/data/configs"
@@ -119,6 +115,7 @@ func TestFalco_Legacy_StdoutOutputStrict(t *testing.T) {
 		assert.Contains(t, res.Stdout(), scanner.Text())
 	}
 	assert.Nil(t, scanner.Err())
+	assert.Equal(t, 8, res.Detections().OfPriority(falco.PriorityWarning).Count())
 }
 
 func TestFalco_Legacy_StdoutOutputJsonStrict(t *testing.T) {
@@ -132,24 +129,10 @@ func TestFalco_Legacy_StdoutOutputJsonStrict(t *testing.T) {
 		falco.WithArgs("-o", "time_format_iso_8601=true"),
 		falco.WithArgs("-o", "json_include_output_property=true"),
 		falco.WithArgs("-o", "json_include_tags_property=true"),
-		falco.WithEnvVars(map[string]string{"FALCO_HOSTNAME": "test-falco-hostname"}),
 	)
 
-	assert.Equal(t, 0, res.ExitCode())
-	expectedContent, err := outputs.SingleRuleWithCatWriteJSON.Content()
-	assert.Nil(t, err)
-	scanner := bufio.NewScanner(bytes.NewReader(expectedContent))
-	scanner.Split(bufio.ScanLines)
-	var expectedJsonLines []string
-	for scanner.Scan() {
-		expectedJsonLines = append(expectedJsonLines, scanner.Text())
-	}
-	assert.Nil(t, scanner.Err())
-
-	outputLines := strings.Split(res.Stdout(), "\n")
-	for i, expectedLine := range expectedJsonLines {
-		require.JSONEq(t, expectedLine, outputLines[i])
-	}
+	require.Equal(t, 0, res.ExitCode())
+	res.ExpectAlertLinesGolden(t, falco.NormalizeHostname())
 }
 
 func TestFalco_Legacy_ListAppendFalse(t *testing.T) {
@@ -720,6 +703,7 @@ func TestFalco_Legacy_MultipleRulesSuppressInfo(t *testing.T) {
 	assert.Equal(t, 8, res.Detections().OfRule("open_from_cat").Count())
 	assert.Equal(t, 1, res.Detections().OfRule("exec_from_cat").Count())
 	assert.Equal(t, 0, res.Detections().OfRule("access_from_cat").Count())
+	assert.Zero(t, res.Detections().AtMost(falco.PriorityNotice).Count())
 	assert.NoError(t, res.Err(), "%s", res.Stderr())
 	assert.Equal(t, 0, res.ExitCode())
 }
@@ -801,25 +785,24 @@ func TestFalco_Legacy_InvalidRuleOutput(t *testing.T) {
 
 func TestFalco_Legacy_FileOutputStrict(t *testing.T) {
 	t.Parallel()
-	run.WorkDir(func(workDir string) {
-		outFilePath := workDir + "/file_output.txt"
-		res := falco.Test(
-			tests.NewFalcoExecutableRunner(t),
-			falco.WithConfig(configs.FileOutput),
-			falco.WithRules(rules.SingleRule),
-			falco.WithCaptureFile(captures.CatWrite),
-			falco.WithArgs("-o", "time_format_iso_8601=true"),
-			falco.WithArgs("-o", "file_output.filename="+outFilePath),
-		)
-
-		outFile := run.NewLocalFileAccessor(outFilePath, outFilePath)
-		actualContent, err1 := outFile.Content()
-		expectedContent, err2 := outputs.SingleRuleWithCatWriteText.Content()
-		assert.Nil(t, err1)
-		assert.Nil(t, err2)
-		assert.Equal(t, string(expectedContent), string(actualContent))
-		assert.Equal(t, 0, res.ExitCode())
-	})
+	sink, err := falco.NewFileOutputSink()
+	require.Nil(t, err)
+	res := falco.Test(
+		tests.NewFalcoExecutableRunner(t),
+		falco.WithConfig(configs.FileOutput),
+		falco.WithRules(rules.SingleRule),
+		falco.WithCaptureFile(captures.CatWrite),
+		falco.WithArgs("-o", "time_format_iso_8601=true"),
+		falco.WithOutputSinks(sink),
+	)
+
+	actualContent, err1 := sink.Content()
+	expectedContent, err2 := outputs.SingleRuleWithCatWriteText.Content()
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Equal(t, string(expectedContent), string(actualContent))
+	assert.Equal(t, 8, sink.Detections().OfPriority(falco.PriorityWarning).Count())
+	assert.Equal(t, 0, res.ExitCode())
 }
 
 func TestFalco_Legacy_RunTagsBc(t *testing.T) {
@@ -1506,25 +1489,31 @@ func TestFalco_Legacy_MultipleRulesFirstEmpty(t *testing.T) {
 
 func TestFalco_Legacy_ProgramOutputStrict(t *testing.T) {
 	t.Parallel()
+	sink, err := falco.NewProgramOutputSink()
+	require.Nil(t, err)
 	res := falco.Test(
 		tests.NewFalcoExecutableRunner(t),
 		falco.WithConfig(configs.ProgramOutput),
 		falco.WithRules(rules.SingleRule),
 		falco.WithCaptureFile(captures.CatWrite),
 		falco.WithArgs("-o", "time_format_iso_8601=true"),
-		falco.WithArgs("-o", "program_output.program=cat"),
 		falco.WithArgs("-o", "stdout_output.enabled=false"),
+		falco.WithOutputSinks(sink),
 	)
 
 	assert.Equal(t, 0, res.ExitCode())
+	assert.Equal(t, 0, res.Detections().Count())
+	actualContent, err := sink.Content()
+	assert.Nil(t, err)
 	expectedContent, err := outputs.SingleRuleWithCatWriteText.Content()
 	assert.Nil(t, err)
 	scanner := bufio.NewScanner(bytes.NewReader(expectedContent))
 	scanner.Split(bufio.ScanLines)
 	for scanner.Scan() {
-		assert.Contains(t, res.Stdout(), scanner.Text())
+		assert.Contains(t, string(actualContent), scanner.Text())
 	}
 	assert.Nil(t, scanner.Err())
+	assert.Equal(t, 8, sink.Detections().OfPriority(falco.PriorityWarning).Count())
 }
 
 func TestFalco_Legacy_InvalidAppendRule(t *testing.T) {
@@ -2885,23 +2874,6 @@ func TestFalco_Legacy_TestWarnings(t *testing.T) {
 	assert.NotNil(t, warnings.OfItemName("not_with_evttypes_addl"))
 }
 
-func grpcOutputResponseToFalcoAlert(res *grpcOutputs.Response) *falco.Alert {
-	outputFields := make(map[string]interface{})
-	for k, v := range res.OutputFields {
-		outputFields[k] = v
-	}
-	return &falco.Alert{
-		Time:         res.Time.AsTime(),
-		Rule:         res.Rule,
-		Output:       res.Output,
-		Priority:     res.Priority.String(),
-		Source:       res.Source,
-		Hostname:     res.Hostname,
-		Tags:         res.Tags,
-		OutputFields: outputFields,
-	}
-}
-
 func TestFalco_Legacy_NoPluginsUnknownSource(t *testing.T) {
 	t.Parallel()
 	checkConfig(t)
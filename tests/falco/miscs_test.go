@@ -20,11 +20,12 @@ package testfalco
 
 import (
 	"github.com/falcosecurity/testing/pkg/run"
+	"github.com/falcosecurity/testing/tests/data/captures"
 	"github.com/falcosecurity/testing/tests/data/rules"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sync"
+	"regexp"
 	"testing"
 	"time"
 
@@ -37,8 +38,8 @@ import (
 
 // todo(jasondellaluce): implement tests for the non-covered Falco config fields:
 //   watch_config_files, libs_logger, buffered_outputs, syscall_event_timeouts,
-//   syslog_output, file_output, stdout_output, webserver, program_output,
-//   http_output, metadata_download, output_timeout, outputs
+//   file_output, stdout_output, webserver, program_output,
+//   metadata_download, outputs
 //
 // todo(jasondellaluce): test Falco behavior on environment variables and their
 // priorities in combination with their args/configs/cmds counterparts:
@@ -101,38 +102,111 @@ func TestFalco_Miscs_HotReload(t *testing.T) {
 		falco.WithConfig(hotReloadCfg),
 		falco.WithRules(rules.SingleRule),
 		falco.WithStopAfter(5*time.Second),
-		falco.WithArgs("-o", "engine.kind=nodriver"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineNoDriver}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
 	// We want to be sure that the hot reload was triggered
-	assert.Regexp(t, `SIGHUP received, restarting...`, falcoRes.Stderr())
+	assert.NotEmpty(t, falcoRes.Logs().Matching("SIGHUP received, restarting..."), "%s", falcoRes.Stderr())
 }
 
 func TestFalco_Miscs_PrometheusMetricsNoDriver(t *testing.T) {
-	var (
-		wg         sync.WaitGroup
-		metricsErr error
+	t.Parallel()
+	falcoRes := falco.Test(
+		tests.NewFalcoExecutableRunner(t),
+		falco.WithMetricsScraping(time.Second),
+		falco.WithRules(rules.SingleRule),
+		falco.WithStopAfter(5*time.Second),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineNoDriver}),
 	)
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		time.Sleep(2 * time.Second)
-		_, metricsErr = http.Get("http://127.0.0.1:8765/metrics")
-	}()
+	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
+	assert.Equal(t, 0, falcoRes.ExitCode())
+	assert.NoError(t, falcoRes.Metrics().Err)
+	if assert.NotNil(t, falcoRes.Metrics().Final()) {
+		assert.NotEmpty(t, falcoRes.Metrics().Final().Samples.OfNameMatching(regexp.MustCompile(`^falcosecurity_`)))
+	}
+}
 
+func TestFalco_Miscs_InternalMetricsNoDriver(t *testing.T) {
+	t.Parallel()
 	falcoRes := falco.Test(
 		tests.NewFalcoExecutableRunner(t),
-		falco.WithPrometheusMetrics(),
+		falco.WithOutputJSON(),
+		falco.WithInternalMetrics(time.Second),
+		falco.WithInternalMetricsFile(),
 		falco.WithRules(rules.SingleRule),
 		falco.WithStopAfter(5*time.Second),
-		falco.WithArgs("-o", "engine.kind=nodriver"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineNoDriver}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
+	series := falcoRes.InternalMetrics()
+	assert.NotZero(t, series.Count())
+	assert.NotZero(t, falcoRes.Detections().OfRule(falco.InternalMetricsRule).Count())
+	for _, m := range series {
+		assert.NotZero(t, len(m.Values))
+	}
+}
+
+func TestFalco_Miscs_HTTPOutput(t *testing.T) {
+	checkConfig(t)
+	res := falco.Test(
+		tests.NewFalcoExecutableRunner(t),
+		falco.WithOutputJSON(),
+		falco.WithRules(rules.SingleRule),
+		falco.WithCaptureFile(captures.CatWrite),
+		falco.WithHTTPOutput(),
+	)
+	assert.NoError(t, res.Err(), "%s", res.Stderr())
+	assert.Equal(t, 0, res.ExitCode())
+	requests := res.HTTPOutput().Requests()
+	assert.NotEmpty(t, requests)
+	for _, req := range requests {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.ContentType)
+	}
+	assert.Equal(t, 8, res.HTTPOutput().Detections().OfRule("open_from_cat").Count())
+}
 
-	wg.Wait()
+func TestFalco_Miscs_OutputTimeout(t *testing.T) {
+	checkConfig(t)
+	res := falco.Test(
+		tests.NewFalcoExecutableRunner(t),
+		falco.WithOutputJSON(),
+		falco.WithRules(rules.SingleRule),
+		falco.WithCaptureFile(captures.CatWrite),
+		falco.WithOutputTimeout(100*time.Millisecond),
+		falco.WithProgramOutput(falco.WithProgramDelay(500*time.Millisecond)),
+	)
+	assert.NoError(t, res.Err(), "%s", res.Stderr())
+	assert.Equal(t, 0, res.ExitCode())
+	assert.NotZero(t, res.OutputEvents().Timeouts().Count())
+	assert.Zero(t, res.OutputEvents().QueueDrops().Count())
+	// slow outputs are delayed, not dropped
+	assert.Equal(t, 8, res.OutputSink("program_output").Detections().OfRule("open_from_cat").Count())
+}
 
-	assert.NoError(t, metricsErr)
+func TestFalco_Miscs_SyslogOutput(t *testing.T) {
+	checkConfig(t)
+	// Falco sends syslog messages to the default socket, so we can only
+	// listen on it if no syslog daemon is already doing so
+	if _, err := os.Stat(falco.DefaultSyslogSocket); err == nil {
+		t.Skipf("a syslog daemon is already listening on %s", falco.DefaultSyslogSocket)
+	}
+	res := falco.Test(
+		tests.NewFalcoExecutableRunner(t),
+		falco.WithRules(rules.SingleRule),
+		falco.WithCaptureFile(captures.CatWrite),
+		falco.WithSyslogOutput("unixgram", falco.DefaultSyslogSocket),
+	)
+	assert.NoError(t, res.Err(), "%s", res.Stderr())
+	assert.Equal(t, 0, res.ExitCode())
+	if !assert.NotNil(t, res.SyslogOutput()) {
+		return
+	}
+	assert.Empty(t, res.SyslogOutput().Errors())
+	for _, m := range res.SyslogOutput().Messages() {
+		assert.Equal(t, "falco", m.Tag)
+	}
+	assert.Equal(t, 8, res.SyslogOutput().Detections().OfPriority(falco.PriorityWarning).Count())
 }
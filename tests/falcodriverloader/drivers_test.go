@@ -54,13 +54,12 @@ func TestFalcoLegacyBPF(t *testing.T) {
 	falcoRes := falco.Test(
 		tests.NewFalcoExecutableRunner(t),
 		falco.WithStopAfter(3*time.Second),
-		falco.WithArgs("-o", "engine.kind=ebpf"),
-		falco.WithArgs("-o", "engine.ebpf.probe=/root/.falco/falco-bpf.o"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineEBPF, Probe: "/root/.falco/falco-bpf.o"}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
 	// We want to be sure to run the BPF probe.
-	assert.Regexp(t, `source with BPF probe`, falcoRes.Stderr())
+	assert.NotEmpty(t, falcoRes.Logs().Matching("source with BPF probe"), "%s", falcoRes.Stderr())
 	// We want to be sure that the engine is correctly opened.
 	assert.Regexp(t, `Events detected:`, falcoRes.Stdout())
 }
@@ -90,12 +89,12 @@ func TestFalcoKmod(t *testing.T) {
 	falcoRes := falco.Test(
 		tests.NewFalcoExecutableRunner(t),
 		falco.WithStopAfter(3*time.Second),
-		falco.WithArgs("-o", "engine.kind=kmod"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineKmod}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
 	// We want to be sure to run the Kernel module.
-	assert.Regexp(t, `source with Kernel module`, falcoRes.Stderr())
+	assert.NotEmpty(t, falcoRes.Logs().Matching("source with Kernel module"), "%s", falcoRes.Stderr())
 	// We want to be sure that the engine is correctly opened.
 	assert.Regexp(t, `Events detected:`, falcoRes.Stdout())
 }
@@ -107,12 +106,12 @@ func TestFalcoModernBpf(t *testing.T) {
 	falcoRes := falco.Test(
 		tests.NewFalcoExecutableRunner(t),
 		falco.WithStopAfter(3*time.Second),
-		falco.WithArgs("-o", "engine.kind=modern_ebpf"),
+		falco.WithEngine(&falco.Engine{Kind: falco.EngineModernEBPF}),
 	)
 	assert.NoError(t, falcoRes.Err(), "%s", falcoRes.Stderr())
 	assert.Equal(t, 0, falcoRes.ExitCode())
 	// We want to be sure to run the Kernel module.
-	assert.Regexp(t, `source with modern BPF probe`, falcoRes.Stderr())
+	assert.NotEmpty(t, falcoRes.Logs().Matching("source with modern BPF probe"), "%s", falcoRes.Stderr())
 	// We want to be sure that the engine is correctly opened.
 	assert.Regexp(t, `Events detected:`, falcoRes.Stdout())
 }
@@ -69,9 +69,11 @@ func TestK8SAudit_Legacy_CreateSensitiveMountPod(t *testing.T) {
 			rules.LegacyFalcoRules_v1_0_1,
 			rules.K8SAuditRules),
 	)
-	assert.NotZero(t, res.Detections().Count())
-	assert.NotZero(t, res.Detections().OfPriority("WARNING").Count())
-	assert.Equal(t, 1, res.Detections().OfRule("Create Sensitive Mount Pod").Count())
+	res.Expect(t, &falco.Expectations{
+		Rules: []falco.RuleExpectation{
+			{Rule: "Create Sensitive Mount Pod", Count: falco.Ptr(1), Priority: falco.PriorityWarning},
+		},
+	})
 	assert.NoError(t, res.Err(), "%s", res.Stderr())
 	assert.Equal(t, 0, res.ExitCode())
 }
@@ -86,9 +88,11 @@ func TestK8SAudit_Legacy_CreateService(t *testing.T) {
 			rules.LegacyFalcoRules_v1_0_1,
 			rules.K8SAuditRules),
 	)
-	assert.NotZero(t, res.Detections().Count())
-	assert.NotZero(t, res.Detections().OfPriority("INFO").Count())
-	assert.Equal(t, 1, res.Detections().OfRule("K8s Service Created").Count())
+	res.Expect(t, &falco.Expectations{
+		Rules: []falco.RuleExpectation{
+			{Rule: "K8s Service Created", Count: falco.Ptr(1), Priority: falco.PriorityInformational},
+		},
+	})
 	assert.NoError(t, res.Err(), "%s", res.Stderr())
 	assert.Equal(t, 0, res.ExitCode())
 }
@@ -34,21 +34,40 @@ var (
 	falcoStatic    = false
 	falcoBinary    = falco.DefaultExecutable
 	falcoctlBinary = falcoctl.DefaultLocalExecutable
+	falcoWrapper   = ""
 )
 
+var wrapperTools = map[string]*run.WrapperTool{
+	"valgrind": run.ValgrindMemcheckTool,
+	"strace":   run.StraceTool,
+	"ltrace":   run.LtraceTool,
+}
+
 func init() {
 	flag.BoolVar(&falcoStatic, "falco-static", falcoStatic, "True if the Falco executable is from a static build")
 	flag.StringVar(&falcoBinary, "falco-binary", falcoBinary, "Falco executable binary path")
+	flag.StringVar(&falcoWrapper, "falco-wrapper", falcoWrapper, "Instrumentation tool wrapping the Falco executable, one of: valgrind, strace, ltrace (disabled if empty)")
 	flag.StringVar(&falcoctlBinary, "falcoctl-binary", falcoctlBinary, "falcoctl executable binary path")
 	flag.StringVar(&falco.FalcoConfig, "falco-config", falco.FalcoConfig, "Falco config file path")
 	flag.StringVar(&falco.FalcoContainerPluginLibrary, "falco-container-plugin", falco.FalcoContainerPluginLibrary, "Path to the Falco container plugin shared object.")
+	flag.BoolVar(&falco.UpdateGolden, "update", falco.UpdateGolden, "Update the golden files of snapshot tests instead of comparing with them (must run from the test package directory)")
+	flag.StringVar(&falco.FalcoCrashArtifactsDir, "falco-crash-artifacts", falco.FalcoCrashArtifactsDir, "Directory in which core dumps and stderr are collected when Falco crashes (disabled if empty)")
 
 	logrus.SetLevel(logrus.DebugLevel)
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 }
 
 // NewFalcoExecutableRunner returns an executable runner for Falco.
+// If an instrumentation tool is set with the -falco-wrapper flag, Falco
+// runs wrapped by it.
 func NewFalcoExecutableRunner(t *testing.T) run.Runner {
+	if len(falcoWrapper) > 0 {
+		tool, ok := wrapperTools[falcoWrapper]
+		require.True(t, ok, "unknown Falco wrapper tool: %s", falcoWrapper)
+		runner, err := run.NewWrapperRunner(falcoBinary, tool)
+		require.Nil(t, err)
+		return runner
+	}
 	runner, err := run.NewExecutableRunner(falcoBinary)
 	require.Nil(t, err)
 	return runner
@@ -56,13 +75,23 @@ func NewFalcoExecutableRunner(t *testing.T) run.Runner {
 
 // NewFalcoctlExecutableRunner returns an executable runner for falcoctl.
 func NewFalcoctlExecutableRunner(t *testing.T) run.Runner {
+	return newFalcoctlExecutableRunner(t, nil)
+}
+
+// NewFalcoctlPTYExecutableRunner returns an executable runner for falcoctl
+// that runs attached to a pseudo-terminal.
+func NewFalcoctlPTYExecutableRunner(t *testing.T) run.Runner {
+	return newFalcoctlExecutableRunner(t, &run.ExecutableRunnerOptions{PTY: true})
+}
+
+func newFalcoctlExecutableRunner(t *testing.T, options *run.ExecutableRunnerOptions) run.Runner {
 	if _, err := os.Stat(falcoctlBinary); err == nil {
-		runner, err := run.NewExecutableRunner(falcoctlBinary)
+		runner, err := run.NewExecutableRunnerWithOptions(falcoctlBinary, options)
 		require.Nil(t, err)
 		return runner
 	}
 	logrus.Debug("using falcoctl default executable location")
-	runner, err := run.NewExecutableRunner(falcoctl.DefaultExecutable)
+	runner, err := run.NewExecutableRunnerWithOptions(falcoctl.DefaultExecutable, options)
 	require.Nil(t, err)
 	return runner
 }